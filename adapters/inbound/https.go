@@ -3,11 +3,14 @@ package adapters
 import (
 	"net"
 	"net/http"
+
+	C "github.com/ClashrAuto/Clashr/constant"
 )
 
 // NewHTTPS is HTTPAdapter generator
 func NewHTTPS(request *http.Request, conn net.Conn) *SocketAdapter {
 	metadata := parseHTTPAddr(request)
+	metadata.Type = C.HTTPCONNECT
 	if ip, port, err := parseAddr(conn.RemoteAddr().String()); err == nil {
 		metadata.SrcIP = ip
 		metadata.SrcPort = port
@@ -5,10 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"net"
-	"net/http"
 	"time"
 
 	"github.com/ClashrAuto/Clashr/common/queue"
+	"github.com/ClashrAuto/Clashr/component/dialer"
+	"github.com/ClashrAuto/Clashr/component/health"
 	C "github.com/ClashrAuto/Clashr/constant"
 )
 
@@ -17,9 +18,25 @@ var (
 )
 
 type Base struct {
-	name string
-	tp   C.AdapterType
-	udp  bool
+	name    string
+	tp      C.AdapterType
+	udp     bool
+	sockopt *dialer.Option
+}
+
+// BasicOption is the socket options shared by the proxies connecting to a server
+type BasicOption struct {
+	Interface   string `proxy:"interface-name,omitempty"`
+	RoutingMark int    `proxy:"routing-mark,omitempty"`
+	SourceIP    string `proxy:"source-ip,omitempty"`
+}
+
+func (o BasicOption) socketOption() *dialer.Option {
+	return &dialer.Option{
+		Interface:   o.Interface,
+		RoutingMark: o.RoutingMark,
+		SourceIP:    net.ParseIP(o.SourceIP),
+	}
 }
 
 func (b *Base) Name() string {
@@ -84,10 +101,12 @@ type Proxy struct {
 	C.ProxyAdapter
 	history *queue.Queue
 	alive   bool
+	health  *health.Tracker
 }
 
+// Alive return false if the last url test failed or the passive health check marks it unhealthy
 func (p *Proxy) Alive() bool {
-	return p.alive
+	return p.alive && (p.health == nil || p.health.Available())
 }
 
 func (p *Proxy) Dial(metadata *C.Metadata) (C.Conn, error) {
@@ -97,11 +116,22 @@ func (p *Proxy) Dial(metadata *C.Metadata) (C.Conn, error) {
 }
 
 func (p *Proxy) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
+	if p.health != nil {
+		p.health.Attempt()
+	}
 	conn, err := p.ProxyAdapter.DialContext(ctx, metadata)
+	if p.health == nil {
+		if err != nil {
+			p.alive = false
+		}
+		return conn, err
+	}
+
 	if err != nil {
-		p.alive = false
+		p.health.Failure(failureKind(err))
+		return nil, err
 	}
-	return conn, err
+	return &healthConn{Conn: conn, health: p.health, start: time.Now()}, nil
 }
 
 func (p *Proxy) DelayHistory() []C.DelayHistory {
@@ -140,16 +170,29 @@ func (p *Proxy) MarshalJSON() ([]byte, error) {
 	mapping := map[string]interface{}{}
 	json.Unmarshal(inner, &mapping)
 	mapping["history"] = p.DelayHistory()
+	if p.health != nil {
+		mapping["health"] = p.health.Snapshot()
+	}
 	return json.Marshal(mapping)
 }
 
 // URLTest get the delay for the specified URL
-func (p *Proxy) URLTest(ctx context.Context, url string) (t uint16, err error) {
+func (p *Proxy) URLTest(ctx context.Context, url string) (uint16, error) {
+	return p.Check(ctx, &Probe{Type: ProbeHTTP, URL: url})
+}
+
+// Check run probe through the proxy and record the result in the history
+func (p *Proxy) Check(ctx context.Context, probe *Probe) (t uint16, err error) {
 	defer func() {
 		p.alive = err == nil
+		if err == nil && p.health != nil {
+			p.health.Success()
+		}
 		record := C.DelayHistory{Time: time.Now()}
 		if err == nil {
 			record.Delay = t
+		} else if pe, ok := err.(*ProbeError); ok {
+			record.Failure = pe.Stage
 		}
 		p.history.Put(record)
 		if p.history.Len() > 10 {
@@ -157,47 +200,15 @@ func (p *Proxy) URLTest(ctx context.Context, url string) (t uint16, err error) {
 		}
 	}()
 
-	addr, err := urlToMetadata(url)
-	if err != nil {
-		return
-	}
-
-	start := time.Now()
-	instance, err := p.DialContext(ctx, &addr)
-	if err != nil {
-		return
-	}
-	defer instance.Close()
-
-	req, err := http.NewRequest(http.MethodHead, url, nil)
-	if err != nil {
-		return
-	}
-	req = req.WithContext(ctx)
-
-	transport := &http.Transport{
-		Dial: func(string, string) (net.Conn, error) {
-			return instance, nil
-		},
-		// from http.DefaultTransport
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-	}
-
-	client := http.Client{Transport: transport}
-	resp, err := client.Do(req)
-	if err != nil {
-		return
-	}
-	resp.Body.Close()
-	t = uint16(time.Since(start) / time.Millisecond)
-	return
+	return probe.run(ctx, p)
 }
 
 func NewProxy(adapter C.ProxyAdapter) *Proxy {
-	return &Proxy{adapter, queue.New(10), true}
+	proxy := &Proxy{ProxyAdapter: adapter, history: queue.New(10), alive: true}
+	if trackHealth(adapter.Type()) {
+		proxy.health = health.NewTracker(health.Option{})
+	}
+	return proxy
 }
 
 // ProxyGroupOption contain the common options for all kind of ProxyGroup
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net"
 
+	"github.com/ClashrAuto/Clashr/component/dialer"
 	C "github.com/ClashrAuto/Clashr/constant"
 )
 
@@ -17,7 +18,7 @@ func (d *Direct) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn,
 		address = net.JoinHostPort(metadata.DstIP.String(), metadata.DstPort)
 	}
 
-	c, err := dialContext(ctx, "tcp", address)
+	c, err := dialContext(ctx, "tcp", address, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -26,7 +27,7 @@ func (d *Direct) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn,
 }
 
 func (d *Direct) DialUDP(metadata *C.Metadata) (C.PacketConn, net.Addr, error) {
-	pc, err := net.ListenPacket("udp", "")
+	pc, err := dialer.ListenPacket("udp", "", nil)
 	if err != nil {
 		return nil, nil, err
 	}
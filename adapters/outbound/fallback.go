@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"net"
-	"sync"
 	"time"
 
 	C "github.com/ClashrAuto/Clashr/constant"
@@ -13,10 +12,8 @@ import (
 
 type Fallback struct {
 	*Base
-	proxies  []C.Proxy
-	rawURL   string
-	interval time.Duration
-	done     chan struct{}
+	proxies     []C.Proxy
+	healthCheck *Registration
 }
 
 type FallbackOption struct {
@@ -24,6 +21,8 @@ type FallbackOption struct {
 	Proxies  []string `proxy:"proxies"`
 	URL      string   `proxy:"url"`
 	Interval int      `proxy:"interval"`
+
+	HealthCheck map[string]interface{} `proxy:"health-check,omitempty"`
 }
 
 func (f *Fallback) Now() string {
@@ -54,6 +53,10 @@ func (f *Fallback) SupportUDP() bool {
 	return proxy.SupportUDP()
 }
 
+func (f *Fallback) Proxies() []C.Proxy {
+	return f.proxies
+}
+
 func (f *Fallback) MarshalJSON() ([]byte, error) {
 	var all []string
 	for _, proxy := range f.proxies {
@@ -67,21 +70,7 @@ func (f *Fallback) MarshalJSON() ([]byte, error) {
 }
 
 func (f *Fallback) Destroy() {
-	f.done <- struct{}{}
-}
-
-func (f *Fallback) loop() {
-	tick := time.NewTicker(f.interval)
-	go f.validTest()
-Loop:
-	for {
-		select {
-		case <-tick.C:
-			go f.validTest()
-		case <-f.done:
-			break Loop
-		}
-	}
+	f.healthCheck.Close()
 }
 
 func (f *Fallback) findAliveProxy() C.Proxy {
@@ -93,20 +82,6 @@ func (f *Fallback) findAliveProxy() C.Proxy {
 	return f.proxies[0]
 }
 
-func (f *Fallback) validTest() {
-	wg := sync.WaitGroup{}
-	wg.Add(len(f.proxies))
-
-	for _, p := range f.proxies {
-		go func(p C.Proxy) {
-			p.URLTest(context.Background(), f.rawURL)
-			wg.Done()
-		}(p)
-	}
-
-	wg.Wait()
-}
-
 func NewFallback(option FallbackOption, proxies []C.Proxy) (*Fallback, error) {
 	_, err := urlToMetadata(option.URL)
 	if err != nil {
@@ -117,6 +92,11 @@ func NewFallback(option FallbackOption, proxies []C.Proxy) (*Fallback, error) {
 		return nil, errors.New("The number of proxies cannot be 0")
 	}
 
+	probe, err := newProbe(option.URL, option.HealthCheck)
+	if err != nil {
+		return nil, err
+	}
+
 	interval := time.Duration(option.Interval) * time.Second
 
 	Fallback := &Fallback{
@@ -124,11 +104,12 @@ func NewFallback(option FallbackOption, proxies []C.Proxy) (*Fallback, error) {
 			name: option.Name,
 			tp:   C.Fallback,
 		},
-		proxies:  proxies,
-		rawURL:   option.URL,
-		interval: interval,
-		done:     make(chan struct{}),
+		proxies: proxies,
 	}
-	go Fallback.loop()
+	Fallback.healthCheck = healthCheckScheduler.Register(HealthCheck{
+		Proxies:  proxies,
+		Probe:    probe,
+		Interval: interval,
+	})
 	return Fallback, nil
 }
@@ -0,0 +1,80 @@
+package adapters
+
+import (
+	"context"
+	"sync"
+
+	C "github.com/ClashrAuto/Clashr/constant"
+)
+
+// ProxyGroup is a proxy adapter made of other proxies
+type ProxyGroup interface {
+	C.ProxyAdapter
+	Proxies() []C.Proxy
+}
+
+// asGroup return the ProxyGroup behind proxy
+func asGroup(proxy C.Proxy) (ProxyGroup, bool) {
+	if p, ok := proxy.(*Proxy); ok {
+		group, ok := p.ProxyAdapter.(ProxyGroup)
+		return group, ok
+	}
+	group, ok := proxy.(ProxyGroup)
+	return group, ok
+}
+
+// URLTestGroup test every member of group concurrently and return the delay by name, 0 means failed.
+// Nested groups are replaced by their members if recursive, and url-test groups re-pick after the test.
+func URLTestGroup(ctx context.Context, group ProxyGroup, url string, recursive bool) map[string]uint16 {
+	members := map[string]C.Proxy{}
+	urlTests := []*URLTest{}
+
+	var collect func(group ProxyGroup)
+	collect = func(group ProxyGroup) {
+		if u, ok := group.(*URLTest); ok {
+			urlTests = append(urlTests, u)
+		}
+
+		for _, proxy := range group.Proxies() {
+			if _, exist := members[proxy.Name()]; exist {
+				continue
+			}
+
+			if nested, ok := asGroup(proxy); ok && recursive {
+				members[proxy.Name()] = nil
+				collect(nested)
+				continue
+			}
+			members[proxy.Name()] = proxy
+		}
+	}
+	collect(group)
+
+	mux := sync.Mutex{}
+	delays := map[string]uint16{}
+	wg := sync.WaitGroup{}
+	for name, proxy := range members {
+		if proxy == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(name string, proxy C.Proxy) {
+			defer wg.Done()
+			delay, err := proxy.URLTest(ctx, url)
+			if err != nil {
+				delay = 0
+			}
+
+			mux.Lock()
+			delays[name] = delay
+			mux.Unlock()
+		}(name, proxy)
+	}
+	wg.Wait()
+
+	for _, u := range urlTests {
+		u.onChecked()
+	}
+	return delays
+}
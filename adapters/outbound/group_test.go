@@ -0,0 +1,26 @@
+package adapters
+
+import (
+	"context"
+	"testing"
+
+	C "github.com/ClashrAuto/Clashr/constant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURLTestGroup_Recursive(t *testing.T) {
+	a, b, c := &fakeProxy{name: "a", delay: 100}, &fakeProxy{name: "b", delay: 50}, &fakeProxy{name: "c", delay: 0xffff}
+
+	auto := newTestURLTest(t, URLTestOption{Lazy: true}, a, b)
+	defer auto.Destroy()
+	assert.Equal(t, "a", auto.Now())
+
+	outer, err := NewSelector("outer", []C.Proxy{NewProxy(auto), a, c})
+	assert.Nil(t, err)
+
+	delays := URLTestGroup(context.Background(), outer, "http://www.gstatic.com/generate_204", true)
+	assert.Equal(t, map[string]uint16{"a": 100, "b": 50, "c": 0xffff}, delays)
+
+	// the nested url-test group re-picks immediately
+	assert.Equal(t, "b", auto.Now())
+}
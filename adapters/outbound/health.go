@@ -0,0 +1,70 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/ClashrAuto/Clashr/component/health"
+	C "github.com/ClashrAuto/Clashr/constant"
+)
+
+// earlyResetTimeout is how soon a connection closed without any byte counts as a failure
+const earlyResetTimeout = 5 * time.Second
+
+// trackHealth return true for the adapters connecting to a proxy server,
+// the failures of DIRECT, REJECT and groups are not a sign of an unhealthy server.
+func trackHealth(tp C.AdapterType) bool {
+	switch tp {
+	case C.Shadowsocks, C.ShadowsocksR, C.Snell, C.Socks5, C.Http, C.Vmess, C.WireGuard:
+		return true
+	default:
+		return false
+	}
+}
+
+func failureKind(err error) health.Kind {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return health.Timeout
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return health.Timeout
+	}
+	return health.DialFailure
+}
+
+// healthConn report the first read of a connection to the tracker
+type healthConn struct {
+	C.Conn
+	health   *health.Tracker
+	start    time.Time
+	reported int32
+}
+
+func (hc *healthConn) Read(b []byte) (int, error) {
+	n, err := hc.Conn.Read(b)
+	if atomic.LoadInt32(&hc.reported) == 0 {
+		hc.report(n, err)
+	}
+	return n, err
+}
+
+func (hc *healthConn) report(n int, err error) {
+	switch {
+	case n > 0:
+		if atomic.CompareAndSwapInt32(&hc.reported, 0, 1) {
+			hc.health.Success()
+		}
+	case err == io.EOF || errors.Is(err, syscall.ECONNRESET):
+		if atomic.CompareAndSwapInt32(&hc.reported, 0, 1) && time.Since(hc.start) < earlyResetTimeout {
+			hc.health.Failure(health.EarlyReset)
+		}
+	case err != nil:
+		// e.g. the deadline set by the tunnel when the client is gone
+		atomic.StoreInt32(&hc.reported, 1)
+	}
+}
@@ -0,0 +1,46 @@
+package adapters
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"testing"
+
+	C "github.com/ClashrAuto/Clashr/constant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxy_PassiveHealth(t *testing.T) {
+	// a closed port, every dial is refused
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	socks, err := NewSocks5(Socks5Option{Name: "socks", Server: "127.0.0.1", Port: port})
+	assert.Nil(t, err)
+	proxy := NewProxy(socks)
+
+	metadata := &C.Metadata{Host: "example.com", DstPort: strconv.Itoa(80), AddrType: C.AtypDomainName}
+	for i := 0; i < 4; i++ {
+		_, err := proxy.Dial(metadata)
+		assert.NotNil(t, err)
+	}
+	assert.True(t, proxy.Alive())
+
+	proxy.Dial(metadata)
+	assert.False(t, proxy.Alive())
+
+	buf, err := json.Marshal(proxy)
+	assert.Nil(t, err)
+	assert.Contains(t, string(buf), `"state":"unhealthy"`)
+}
+
+func TestProxy_NoPassiveHealth(t *testing.T) {
+	proxy := NewProxy(NewReject())
+	for i := 0; i < 10; i++ {
+		c, _ := proxy.Dial(&C.Metadata{})
+		c.Read(make([]byte, 1))
+	}
+	assert.True(t, proxy.Alive())
+}
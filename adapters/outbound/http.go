@@ -27,17 +27,19 @@ type Http struct {
 }
 
 type HttpOption struct {
-	Name           string `proxy:"name"`
-	Server         string `proxy:"server"`
-	Port           int    `proxy:"port"`
-	UserName       string `proxy:"username,omitempty"`
-	Password       string `proxy:"password,omitempty"`
-	TLS            bool   `proxy:"tls,omitempty"`
-	SkipCertVerify bool   `proxy:"skip-cert-verify,omitempty"`
+	BasicOption
+	Name           string                 `proxy:"name"`
+	Server         string                 `proxy:"server"`
+	Port           int                    `proxy:"port"`
+	UserName       string                 `proxy:"username,omitempty"`
+	Password       string                 `proxy:"password,omitempty"`
+	TLS            bool                   `proxy:"tls,omitempty"`
+	SkipCertVerify bool                   `proxy:"skip-cert-verify,omitempty"`
+	TLSOpts        map[string]interface{} `proxy:"tls-opts,omitempty"`
 }
 
 func (h *Http) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
-	c, err := dialContext(ctx, "tcp", h.addr)
+	c, err := dialContext(ctx, "tcp", h.addr, h.sockopt)
 	if err == nil && h.tls {
 		cc := tls.Client(c, h.tlsConfig)
 		err = cc.Handshake()
@@ -100,20 +102,21 @@ func (h *Http) shakeHand(metadata *C.Metadata, rw io.ReadWriter) error {
 	return fmt.Errorf("can not connect remote err code: %d", resp.StatusCode)
 }
 
-func NewHttp(option HttpOption) *Http {
+func NewHttp(option HttpOption) (*Http, error) {
 	var tlsConfig *tls.Config
 	if option.TLS {
-		tlsConfig = &tls.Config{
-			InsecureSkipVerify: option.SkipCertVerify,
-			ClientSessionCache: getClientSessionCache(),
-			ServerName:         option.Server,
+		var err error
+		tlsConfig, err = newTLSConfig(option.TLSOpts, option.Server, option.SkipCertVerify)
+		if err != nil {
+			return nil, fmt.Errorf("http %s initialize tls error: %s", net.JoinHostPort(option.Server, strconv.Itoa(option.Port)), err.Error())
 		}
 	}
 
 	return &Http{
 		Base: &Base{
-			name: option.Name,
-			tp:   C.Http,
+			name:    option.Name,
+			tp:      C.Http,
+			sockopt: option.socketOption(),
 		},
 		addr:           net.JoinHostPort(option.Server, strconv.Itoa(option.Port)),
 		user:           option.UserName,
@@ -121,5 +124,5 @@ func NewHttp(option HttpOption) *Http {
 		tls:            option.TLS,
 		skipCertVerify: option.SkipCertVerify,
 		tlsConfig:      tlsConfig,
-	}
+	}, nil
 }
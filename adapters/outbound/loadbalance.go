@@ -4,23 +4,46 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ClashrAuto/Clashr/common/cache"
 	"github.com/ClashrAuto/Clashr/common/murmur3"
 	C "github.com/ClashrAuto/Clashr/constant"
 
 	"golang.org/x/net/publicsuffix"
 )
 
+// strategies of LoadBalance
+const (
+	ConsistentHashing = "consistent-hashing"
+	RoundRobin        = "round-robin"
+	LeastConnections  = "least-connections"
+	Weighted          = "weighted"
+	StickySessions    = "sticky-sessions"
+)
+
+const defaultStickyTTL = 10 * time.Minute
+
 type LoadBalance struct {
 	*Base
-	proxies  []C.Proxy
-	maxRetry int
-	rawURL   string
-	interval time.Duration
-	done     chan struct{}
+	proxies     []C.Proxy
+	maxRetry    int
+	healthCheck *Registration
+	strategy    string
+	weights     []int
+	stickyTTL   time.Duration
+
+	// conns is the live connections of each proxy
+	conns   []int64
+	counter uint32
+
+	mux     sync.Mutex
+	current []int
+	sticky  *cache.Cache
 }
 
 func getKey(metadata *C.Metadata) string {
@@ -55,80 +78,155 @@ func jumpHash(key uint64, buckets int32) int32 {
 }
 
 func (lb *LoadBalance) DialContext(ctx context.Context, metadata *C.Metadata) (c C.Conn, err error) {
-	defer func() {
-		if err == nil {
-			c.AppendToChains(lb)
-		}
-	}()
-
-	key := uint64(murmur3.Sum32([]byte(getKey(metadata))))
-	buckets := int32(len(lb.proxies))
-	for i := 0; i < lb.maxRetry; i, key = i+1, key+1 {
-		idx := jumpHash(key, buckets)
-		proxy := lb.proxies[idx]
-		if proxy.Alive() {
-			c, err = proxy.DialContext(ctx, metadata)
-			return
-		}
+	idx := lb.pick(metadata)
+	c, err = lb.proxies[idx].DialContext(ctx, metadata)
+	if err != nil {
+		return
 	}
-	c, err = lb.proxies[0].DialContext(ctx, metadata)
-	return
+
+	c.AppendToChains(lb)
+	atomic.AddInt64(&lb.conns[idx], 1)
+	return &lbConn{Conn: c, release: lb.release(idx)}, nil
 }
 
 func (lb *LoadBalance) DialUDP(metadata *C.Metadata) (pc C.PacketConn, addr net.Addr, err error) {
-	defer func() {
-		if err == nil {
-			pc.AppendToChains(lb)
-		}
-	}()
+	idx := lb.pick(metadata)
+	pc, addr, err = lb.proxies[idx].DialUDP(metadata)
+	if err != nil {
+		return
+	}
+
+	pc.AppendToChains(lb)
+	atomic.AddInt64(&lb.conns[idx], 1)
+	return &lbPacketConn{PacketConn: pc, release: lb.release(idx)}, addr, nil
+}
+
+// release return a function decreasing the live connections of proxies[idx] once
+func (lb *LoadBalance) release(idx int) func() {
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			atomic.AddInt64(&lb.conns[idx], -1)
+		})
+	}
+}
+
+// pick return the index of the proxy used by metadata, proxies[0] is used if none is alive
+func (lb *LoadBalance) pick(metadata *C.Metadata) int {
+	switch lb.strategy {
+	case RoundRobin:
+		return lb.roundRobin()
+	case LeastConnections:
+		return lb.leastConnections()
+	case Weighted:
+		return lb.weighted()
+	case StickySessions:
+		return lb.stickySessions(metadata)
+	default:
+		return lb.consistentHashing(metadata)
+	}
+}
 
+func (lb *LoadBalance) consistentHashing(metadata *C.Metadata) int {
 	key := uint64(murmur3.Sum32([]byte(getKey(metadata))))
 	buckets := int32(len(lb.proxies))
 	for i := 0; i < lb.maxRetry; i, key = i+1, key+1 {
-		idx := jumpHash(key, buckets)
-		proxy := lb.proxies[idx]
-		if proxy.Alive() {
-			return proxy.DialUDP(metadata)
+		idx := int(jumpHash(key, buckets))
+		if lb.proxies[idx].Alive() {
+			return idx
 		}
 	}
-
-	return lb.proxies[0].DialUDP(metadata)
+	return 0
 }
 
-func (lb *LoadBalance) SupportUDP() bool {
-	return true
+func (lb *LoadBalance) roundRobin() int {
+	length := uint32(len(lb.proxies))
+	for i := uint32(0); i < length; i++ {
+		idx := int(atomic.AddUint32(&lb.counter, 1) % length)
+		if lb.proxies[idx].Alive() {
+			return idx
+		}
+	}
+	return 0
 }
 
-func (lb *LoadBalance) Destroy() {
-	lb.done <- struct{}{}
+func (lb *LoadBalance) leastConnections() int {
+	picked := -1
+	var min int64
+	for idx, proxy := range lb.proxies {
+		if !proxy.Alive() {
+			continue
+		}
+
+		conns := atomic.LoadInt64(&lb.conns[idx])
+		if picked == -1 || conns < min {
+			picked = idx
+			min = conns
+		}
+	}
+
+	if picked == -1 {
+		return 0
+	}
+	return picked
 }
 
-func (lb *LoadBalance) validTest() {
-	wg := sync.WaitGroup{}
-	wg.Add(len(lb.proxies))
+// weighted is the smooth weighted round-robin of nginx over the alive proxies
+func (lb *LoadBalance) weighted() int {
+	lb.mux.Lock()
+	defer lb.mux.Unlock()
+
+	picked := -1
+	total := 0
+	for idx, proxy := range lb.proxies {
+		if !proxy.Alive() {
+			continue
+		}
 
-	for _, p := range lb.proxies {
-		go func(p C.Proxy) {
-			p.URLTest(context.Background(), lb.rawURL)
-			wg.Done()
-		}(p)
+		lb.current[idx] += lb.weights[idx]
+		total += lb.weights[idx]
+		if picked == -1 || lb.current[idx] > lb.current[picked] {
+			picked = idx
+		}
 	}
 
-	wg.Wait()
+	if picked == -1 {
+		return 0
+	}
+	lb.current[picked] -= total
+	return picked
 }
 
-func (lb *LoadBalance) loop() {
-	tick := time.NewTicker(lb.interval)
-	go lb.validTest()
-Loop:
-	for {
-		select {
-		case <-tick.C:
-			go lb.validTest()
-		case <-lb.done:
-			break Loop
+// stickySessions keep the same source and destination on one proxy until ttl without use
+func (lb *LoadBalance) stickySessions(metadata *C.Metadata) int {
+	key := getKey(metadata)
+	if metadata.SrcIP != nil {
+		key = metadata.SrcIP.String() + "-" + key
+	}
+
+	if elm := lb.sticky.Get(key); elm != nil {
+		idx := elm.(int)
+		if lb.proxies[idx].Alive() {
+			lb.sticky.Put(key, idx, lb.stickyTTL)
+			return idx
 		}
 	}
+
+	idx := lb.roundRobin()
+	lb.sticky.Put(key, idx, lb.stickyTTL)
+	return idx
+}
+
+func (lb *LoadBalance) SupportUDP() bool {
+	return true
+}
+
+func (lb *LoadBalance) Destroy() {
+	lb.healthCheck.Close()
+}
+
+func (lb *LoadBalance) Proxies() []C.Proxy {
+	return lb.proxies
 }
 
 func (lb *LoadBalance) MarshalJSON() ([]byte, error) {
@@ -136,17 +234,62 @@ func (lb *LoadBalance) MarshalJSON() ([]byte, error) {
 	for _, proxy := range lb.proxies {
 		all = append(all, proxy.Name())
 	}
-	return json.Marshal(map[string]interface{}{
-		"type": lb.Type().String(),
-		"all":  all,
-	})
+	mapping := map[string]interface{}{
+		"type":     lb.Type().String(),
+		"all":      all,
+		"strategy": lb.strategy,
+	}
+
+	switch lb.strategy {
+	case LeastConnections:
+		conns := map[string]int64{}
+		for idx, proxy := range lb.proxies {
+			conns[proxy.Name()] = atomic.LoadInt64(&lb.conns[idx])
+		}
+		mapping["connections"] = conns
+	case Weighted:
+		weights := map[string]int{}
+		for idx, proxy := range lb.proxies {
+			weights[proxy.Name()] = lb.weights[idx]
+		}
+		mapping["weights"] = weights
+	case StickySessions:
+		mapping["sticky-ttl"] = int(lb.stickyTTL / time.Second)
+	}
+	return json.Marshal(mapping)
 }
 
 type LoadBalanceOption struct {
-	Name     string   `proxy:"name"`
-	Proxies  []string `proxy:"proxies"`
-	URL      string   `proxy:"url"`
-	Interval int      `proxy:"interval"`
+	Name      string         `proxy:"name"`
+	Proxies   []string       `proxy:"proxies"`
+	URL       string         `proxy:"url"`
+	Interval  int            `proxy:"interval"`
+	Strategy  string         `proxy:"strategy,omitempty"`
+	Weights   map[string]int `proxy:"weights,omitempty"`
+	StickyTTL int            `proxy:"sticky-ttl,omitempty"`
+
+	HealthCheck map[string]interface{} `proxy:"health-check,omitempty"`
+}
+
+// lbConn release the live connection count on Close
+type lbConn struct {
+	C.Conn
+	release func()
+}
+
+func (c *lbConn) Close() error {
+	c.release()
+	return c.Conn.Close()
+}
+
+type lbPacketConn struct {
+	C.PacketConn
+	release func()
+}
+
+func (pc *lbPacketConn) Close() error {
+	pc.release()
+	return pc.PacketConn.Close()
 }
 
 func NewLoadBalance(option LoadBalanceOption, proxies []C.Proxy) (*LoadBalance, error) {
@@ -154,6 +297,46 @@ func NewLoadBalance(option LoadBalanceOption, proxies []C.Proxy) (*LoadBalance,
 		return nil, errors.New("Provide at least one proxy")
 	}
 
+	probe, err := newProbe(option.URL, option.HealthCheck)
+	if err != nil {
+		return nil, err
+	}
+
+	strategy := option.Strategy
+	switch strategy {
+	case "":
+		strategy = ConsistentHashing
+	case ConsistentHashing, RoundRobin, LeastConnections, Weighted, StickySessions:
+	default:
+		return nil, fmt.Errorf("unsupported strategy: %s", strategy)
+	}
+
+	names := map[string]bool{}
+	for _, proxy := range proxies {
+		names[proxy.Name()] = true
+	}
+	for name := range option.Weights {
+		if !names[name] {
+			return nil, fmt.Errorf("weight of %s: not in the proxies of the group", name)
+		}
+	}
+
+	weights := make([]int, len(proxies))
+	for idx, proxy := range proxies {
+		weights[idx] = 1
+		if weight, ok := option.Weights[proxy.Name()]; ok {
+			if weight <= 0 {
+				return nil, fmt.Errorf("weight of %s must be positive", proxy.Name())
+			}
+			weights[idx] = weight
+		}
+	}
+
+	stickyTTL := defaultStickyTTL
+	if option.StickyTTL > 0 {
+		stickyTTL = time.Duration(option.StickyTTL) * time.Second
+	}
+
 	interval := time.Duration(option.Interval) * time.Second
 
 	lb := &LoadBalance{
@@ -161,12 +344,21 @@ func NewLoadBalance(option LoadBalanceOption, proxies []C.Proxy) (*LoadBalance,
 			name: option.Name,
 			tp:   C.LoadBalance,
 		},
-		proxies:  proxies,
-		maxRetry: 3,
-		rawURL:   option.URL,
-		interval: interval,
-		done:     make(chan struct{}),
+		proxies:   proxies,
+		maxRetry:  3,
+		strategy:  strategy,
+		weights:   weights,
+		stickyTTL: stickyTTL,
+		conns:     make([]int64, len(proxies)),
+		current:   make([]int, len(proxies)),
 	}
-	go lb.loop()
+	if strategy == StickySessions {
+		lb.sticky = cache.New(stickyTTL)
+	}
+	lb.healthCheck = healthCheckScheduler.Register(HealthCheck{
+		Proxies:  proxies,
+		Probe:    probe,
+		Interval: interval,
+	})
 	return lb, nil
 }
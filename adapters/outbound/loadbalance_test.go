@@ -0,0 +1,88 @@
+package adapters
+
+import (
+	"net"
+	"testing"
+
+	C "github.com/ClashrAuto/Clashr/constant"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLoadBalance(t *testing.T, option LoadBalanceOption, proxies ...C.Proxy) *LoadBalance {
+	option.Name = "lb"
+	option.URL = "http://www.gstatic.com/generate_204"
+	option.Interval = 300
+
+	lb, err := NewLoadBalance(option, proxies)
+	assert.Nil(t, err)
+	return lb
+}
+
+func TestLoadBalance_RoundRobin(t *testing.T) {
+	a, b, c := &fakeProxy{name: "a"}, &fakeProxy{name: "b", delay: 0xffff}, &fakeProxy{name: "c"}
+	lb := newTestLoadBalance(t, LoadBalanceOption{Strategy: RoundRobin}, a, b, c)
+	defer lb.Destroy()
+
+	picked := []int{}
+	for i := 0; i < 4; i++ {
+		picked = append(picked, lb.pick(&C.Metadata{}))
+	}
+	assert.Equal(t, []int{2, 0, 2, 0}, picked)
+}
+
+func TestLoadBalance_LeastConnections(t *testing.T) {
+	lb := newTestLoadBalance(t, LoadBalanceOption{Strategy: LeastConnections}, &fakeProxy{name: "a"}, &fakeProxy{name: "b"})
+	defer lb.Destroy()
+
+	lb.conns[0] = 2
+	assert.Equal(t, 1, lb.pick(&C.Metadata{}))
+
+	release := lb.release(0)
+	release()
+	release()
+	lb.conns[1] = 3
+	assert.Equal(t, int64(1), lb.conns[0])
+	assert.Equal(t, 0, lb.pick(&C.Metadata{}))
+}
+
+func TestLoadBalance_Weighted(t *testing.T) {
+	lb := newTestLoadBalance(t, LoadBalanceOption{
+		Strategy: Weighted,
+		Weights:  map[string]int{"a": 3},
+	}, &fakeProxy{name: "a"}, &fakeProxy{name: "b"})
+	defer lb.Destroy()
+
+	count := map[int]int{}
+	for i := 0; i < 8; i++ {
+		count[lb.pick(&C.Metadata{})]++
+	}
+	assert.Equal(t, map[int]int{0: 6, 1: 2}, count)
+
+	_, err := NewLoadBalance(LoadBalanceOption{Strategy: "random"}, []C.Proxy{&fakeProxy{}})
+	assert.NotNil(t, err)
+
+	_, err = NewLoadBalance(LoadBalanceOption{
+		Strategy: Weighted,
+		Weights:  map[string]int{"unknown": 2},
+	}, []C.Proxy{&fakeProxy{name: "a"}})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "unknown")
+	}
+}
+
+func TestLoadBalance_StickySessions(t *testing.T) {
+	a, b := &fakeProxy{name: "a"}, &fakeProxy{name: "b"}
+	lb := newTestLoadBalance(t, LoadBalanceOption{Strategy: StickySessions}, a, b)
+	defer lb.Destroy()
+
+	src := net.ParseIP("192.168.1.2")
+	metadata := &C.Metadata{SrcIP: &src, Host: "www.example.com"}
+	first := lb.pick(metadata)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, first, lb.pick(metadata))
+	}
+
+	// move away from the dead one
+	lb.proxies[first].(*fakeProxy).setDelay(0xffff)
+	assert.Equal(t, 1-first, lb.pick(metadata))
+}
@@ -0,0 +1,286 @@
+package adapters
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ClashrAuto/Clashr/common/structure"
+	C "github.com/ClashrAuto/Clashr/constant"
+
+	D "github.com/miekg/dns"
+)
+
+// types of health check probes
+const (
+	ProbeHTTP       = "http"
+	ProbeTCPConnect = "tcp-connect"
+	ProbeUDPDNS     = "udp-dns"
+)
+
+// stages where a probe can fail
+const (
+	StageDial = "dial"
+	StageTLS  = "tls"
+	StageHTTP = "http"
+	StageDNS  = "dns"
+)
+
+const defaultProbeDNSServer = "8.8.8.8:53"
+
+// HealthCheckOption is the health-check block of proxy groups
+type HealthCheckOption struct {
+	Type           string `health:"type,omitempty"`
+	Method         string `health:"method,omitempty"`
+	ExpectedStatus []int  `health:"expected-status,omitempty"`
+	Timeout        int    `health:"timeout,omitempty"`
+	DNSServer      string `health:"dns-server,omitempty"`
+}
+
+// Probe is a health check run through a proxy
+type Probe struct {
+	Type string
+	URL  string
+	// Method and ExpectedStatus are used by http, any status is accepted if ExpectedStatus is empty
+	Method         string
+	ExpectedStatus []int
+	// Timeout of the whole probe, zero means the deadline of the context
+	Timeout time.Duration
+	// DNSServer is the resolver queried by udp-dns
+	DNSServer string
+}
+
+// ProbeError is a failed probe with the stage it failed at
+type ProbeError struct {
+	Stage string
+	Err   error
+}
+
+func (pe *ProbeError) Error() string {
+	return fmt.Sprintf("%s error: %s", pe.Stage, pe.Err.Error())
+}
+
+func (p *Probe) run(ctx context.Context, proxy C.ProxyAdapter) (uint16, error) {
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	var err error
+	switch p.Type {
+	case ProbeTCPConnect:
+		err = p.tcpConnect(ctx, proxy)
+	case ProbeUDPDNS:
+		err = p.udpDNS(ctx, proxy)
+	default:
+		err = p.http(ctx, proxy)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return uint16(time.Since(start) / time.Millisecond), nil
+}
+
+// tcpConnect only establish the connection to the url through the proxy
+func (p *Probe) tcpConnect(ctx context.Context, proxy C.ProxyAdapter) error {
+	addr, err := urlToMetadata(p.URL)
+	if err != nil {
+		return err
+	}
+
+	instance, err := proxy.DialContext(ctx, &addr)
+	if err != nil {
+		return &ProbeError{Stage: StageDial, Err: err}
+	}
+	return instance.Close()
+}
+
+func (p *Probe) http(ctx context.Context, proxy C.ProxyAdapter) error {
+	addr, err := urlToMetadata(p.URL)
+	if err != nil {
+		return err
+	}
+
+	method := p.Method
+	if method == "" {
+		method = http.MethodHead
+	}
+	req, err := http.NewRequest(method, p.URL, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	instance, err := proxy.DialContext(ctx, &addr)
+	if err != nil {
+		return &ProbeError{Stage: StageDial, Err: err}
+	}
+	defer instance.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		instance.SetDeadline(deadline)
+	}
+
+	// do the tls handshake here, so that its failure is told apart from http
+	var conn net.Conn = instance
+	if req.URL.Scheme == "https" {
+		tlsConn := tls.Client(instance, &tls.Config{
+			ServerName:         addr.Host,
+			ClientSessionCache: getClientSessionCache(),
+		})
+		if err := tlsConn.Handshake(); err != nil {
+			return &ProbeError{Stage: StageTLS, Err: err}
+		}
+		conn = tlsConn
+	}
+
+	dial := func(string, string) (net.Conn, error) {
+		return conn, nil
+	}
+	transport := &http.Transport{
+		Dial:    dial,
+		DialTLS: dial,
+		// from http.DefaultTransport
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	client := http.Client{Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return &ProbeError{Stage: StageHTTP, Err: err}
+	}
+	resp.Body.Close()
+
+	if len(p.ExpectedStatus) == 0 {
+		return nil
+	}
+	for _, status := range p.ExpectedStatus {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+	return &ProbeError{Stage: StageHTTP, Err: fmt.Errorf("unexpected status code %d", resp.StatusCode)}
+}
+
+// udpDNS query the A record of the url host from the resolver through the proxy
+func (p *Probe) udpDNS(ctx context.Context, proxy C.ProxyAdapter) error {
+	addr, err := urlToMetadata(p.URL)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := probeDNSMetadata(p.DNSServer)
+	if err != nil {
+		return err
+	}
+
+	pc, remote, err := proxy.DialUDP(metadata)
+	if err != nil {
+		return &ProbeError{Stage: StageDial, Err: err}
+	}
+	defer pc.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		pc.SetDeadline(deadline)
+	}
+
+	msg := &D.Msg{}
+	msg.SetQuestion(D.Fqdn(addr.Host), D.TypeA)
+	query, err := msg.Pack()
+	if err != nil {
+		return err
+	}
+
+	if _, err := pc.WriteTo(query, remote); err != nil {
+		return &ProbeError{Stage: StageDNS, Err: err}
+	}
+
+	buf := make([]byte, 2048)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		return &ProbeError{Stage: StageDNS, Err: err}
+	}
+
+	resp := &D.Msg{}
+	if err := resp.Unpack(buf[:n]); err != nil {
+		return &ProbeError{Stage: StageDNS, Err: err}
+	}
+	if resp.Id != msg.Id {
+		return &ProbeError{Stage: StageDNS, Err: errors.New("mismatched message id")}
+	}
+	return nil
+}
+
+func probeDNSMetadata(server string) (*C.Metadata, error) {
+	if server == "" {
+		server = defaultProbeDNSServer
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &C.Metadata{NetWork: C.UDP, Host: host, DstPort: port, AddrType: C.AtypDomainName}
+	if ip := net.ParseIP(host); ip != nil {
+		metadata.Host = ""
+		metadata.DstIP = &ip
+		metadata.AddrType = C.AtypIPv6
+		if ip.To4() != nil {
+			metadata.AddrType = C.AtypIPv4
+		}
+	}
+	return metadata, nil
+}
+
+// newProbe build the probe of a group from its url and health-check block
+func newProbe(url string, opts map[string]interface{}) (*Probe, error) {
+	option := &HealthCheckOption{}
+	decoder := structure.NewDecoder(structure.Option{TagName: "health", WeaklyTypedInput: true})
+	if err := decoder.Decode(opts, option); err != nil {
+		return nil, err
+	}
+
+	probe := &Probe{
+		Type:           option.Type,
+		URL:            url,
+		Method:         strings.ToUpper(option.Method),
+		ExpectedStatus: option.ExpectedStatus,
+		Timeout:        time.Duration(option.Timeout) * time.Millisecond,
+		DNSServer:      option.DNSServer,
+	}
+
+	switch probe.Type {
+	case "":
+		probe.Type = ProbeHTTP
+	case ProbeHTTP, ProbeTCPConnect:
+	case ProbeUDPDNS:
+		if _, err := probeDNSMetadata(probe.DNSServer); err != nil {
+			return nil, fmt.Errorf("dns-server: %s", err.Error())
+		}
+	default:
+		return nil, fmt.Errorf("unsupported health-check type: %s", probe.Type)
+	}
+	return probe, nil
+}
+
+// check run the probe of a group on proxy
+func check(ctx context.Context, proxy C.Proxy, probe *Probe) (uint16, error) {
+	if p, ok := proxy.(*Proxy); ok {
+		return p.Check(ctx, probe)
+	}
+	return proxy.URLTest(ctx, probe.URL)
+}
@@ -0,0 +1,99 @@
+package adapters
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	D "github.com/miekg/dns"
+)
+
+func probeStage(err error) string {
+	if pe, ok := err.(*ProbeError); ok {
+		return pe.Stage
+	}
+	return ""
+}
+
+func TestProbe_HTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	proxy := NewProxy(NewDirect())
+
+	probe, err := newProbe(server.URL, map[string]interface{}{
+		"method":          "get",
+		"expected-status": []interface{}{204},
+	})
+	assert.Nil(t, err)
+	_, err = proxy.Check(context.Background(), probe)
+	assert.Nil(t, err)
+
+	probe.Method = http.MethodHead
+	_, err = proxy.Check(context.Background(), probe)
+	assert.Equal(t, StageHTTP, probeStage(err))
+	assert.False(t, proxy.Alive())
+
+	history := proxy.DelayHistory()
+	assert.Equal(t, StageHTTP, history[len(history)-1].Failure)
+
+	// a plain http server can't do the tls handshake
+	probe = &Probe{Type: ProbeHTTP, URL: strings.Replace(server.URL, "http://", "https://", 1), Timeout: time.Second}
+	_, err = proxy.Check(context.Background(), probe)
+	assert.Equal(t, StageTLS, probeStage(err))
+}
+
+func TestProbe_TCPConnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	url := "http://" + l.Addr().String()
+
+	proxy := NewProxy(NewDirect())
+	probe, err := newProbe(url, map[string]interface{}{"type": "tcp-connect", "timeout": 1000})
+	assert.Nil(t, err)
+
+	_, err = proxy.Check(context.Background(), probe)
+	assert.Nil(t, err)
+
+	l.Close()
+	_, err = proxy.Check(context.Background(), probe)
+	assert.Equal(t, StageDial, probeStage(err))
+}
+
+func TestProbe_UDPDNS(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := &D.Server{PacketConn: pc, Handler: D.HandlerFunc(func(w D.ResponseWriter, r *D.Msg) {
+		msg := &D.Msg{}
+		msg.SetReply(r)
+		w.WriteMsg(msg)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	proxy := NewProxy(NewDirect())
+	probe, err := newProbe("http://www.example.com", map[string]interface{}{
+		"type":       "udp-dns",
+		"dns-server": pc.LocalAddr().String(),
+		"timeout":    1000,
+	})
+	assert.Nil(t, err)
+
+	_, err = proxy.Check(context.Background(), probe)
+	assert.Nil(t, err)
+
+	_, err = newProbe("http://www.example.com", map[string]interface{}{"type": "icmp"})
+	assert.NotNil(t, err)
+}
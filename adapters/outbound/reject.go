@@ -1,20 +1,35 @@
 package adapters
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"net"
+	"sync"
+	"syscall"
 	"time"
 
 	C "github.com/ClashrAuto/Clashr/constant"
 )
 
+const rejectDropTimeout = 60 * time.Second
+
+// DefaultRejectPage is the body served by REJECT-PAGE without reject-page
+var DefaultRejectPage = []byte(`<!DOCTYPE html>
+<html>
+<head><title>403 Forbidden</title></head>
+<body><h1>403 Forbidden</h1><p>This request is blocked by the proxy rules.</p></body>
+</html>
+`)
+
+// Reject reset the connection immediately
 type Reject struct {
 	*Base
 }
 
 func (r *Reject) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
-	return newConn(&NopConn{}, r), nil
+	return newConn(&resetConn{}, r), nil
 }
 
 func NewReject() *Reject {
@@ -26,6 +41,57 @@ func NewReject() *Reject {
 	}
 }
 
+// RejectDrop discard everything and hold the connection until a timeout,
+// so that clients don't retry aggressively.
+type RejectDrop struct {
+	*Base
+	timeout time.Duration
+}
+
+func (r *RejectDrop) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
+	return newConn(newDropConn(r.timeout), r), nil
+}
+
+func NewRejectDrop() *RejectDrop {
+	return &RejectDrop{
+		Base: &Base{
+			name: "REJECT-DROP",
+			tp:   C.RejectDrop,
+		},
+		timeout: rejectDropTimeout,
+	}
+}
+
+// RejectPage answer plain http requests with a 403 page,
+// other connections can't show a page and are reset like REJECT.
+type RejectPage struct {
+	*Base
+	response []byte
+}
+
+func (r *RejectPage) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
+	if metadata.Type != C.HTTP {
+		return newConn(&resetConn{}, r), nil
+	}
+	return newConn(&pageConn{response: r.response}, r), nil
+}
+
+// NewRejectPage return a RejectPage serving page, DefaultRejectPage is used when page is empty
+func NewRejectPage(page []byte) *RejectPage {
+	if len(page) == 0 {
+		page = DefaultRejectPage
+	}
+
+	header := fmt.Sprintf("HTTP/1.1 403 Forbidden\r\nContent-Type: text/html; charset=utf-8\r\nContent-Length: %d\r\nCache-Control: no-store\r\n\r\n", len(page))
+	return &RejectPage{
+		Base: &Base{
+			name: "REJECT-PAGE",
+			tp:   C.RejectPage,
+		},
+		response: append([]byte(header), page...),
+	}
+}
+
 type NopConn struct{}
 
 func (rw *NopConn) Read(b []byte) (int, error) {
@@ -53,3 +119,76 @@ func (rw *NopConn) SetReadDeadline(time.Time) error { return nil }
 
 // SetWriteDeadline is fake function for net.Conn
 func (rw *NopConn) SetWriteDeadline(time.Time) error { return nil }
+
+// resetConn fail every Read and Write with ECONNRESET,
+// the tunnel passes the reset on to the inbound connection.
+type resetConn struct {
+	NopConn
+}
+
+func (rc *resetConn) Read(b []byte) (int, error) {
+	return 0, &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+}
+
+func (rc *resetConn) Write(b []byte) (int, error) {
+	return 0, &net.OpError{Op: "write", Net: "tcp", Err: syscall.ECONNRESET}
+}
+
+// dropConn swallow writes, Read blocks until the deadline, Close or the timeout
+type dropConn struct {
+	net.Conn
+	peer  net.Conn
+	timer *time.Timer
+}
+
+func (dc *dropConn) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (dc *dropConn) Close() error {
+	dc.timer.Stop()
+	dc.peer.Close()
+	return dc.Conn.Close()
+}
+
+func newDropConn(timeout time.Duration) *dropConn {
+	// the pipe is never written, it only provides a blocking Read with deadlines
+	c, peer := net.Pipe()
+	return &dropConn{
+		Conn:  c,
+		peer:  peer,
+		timer: time.AfterFunc(timeout, func() { peer.Close() }),
+	}
+}
+
+// pageConn reply the response to every request written to it
+type pageConn struct {
+	NopConn
+	response []byte
+
+	mux     sync.Mutex
+	buf     bytes.Buffer
+	pending bool
+}
+
+func (pc *pageConn) Read(b []byte) (int, error) {
+	pc.mux.Lock()
+	defer pc.mux.Unlock()
+
+	if pc.buf.Len() == 0 {
+		if !pc.pending {
+			return 0, io.EOF
+		}
+		pc.buf.Write(pc.response)
+		pc.pending = false
+	}
+	return pc.buf.Read(b)
+}
+
+func (pc *pageConn) Write(b []byte) (int, error) {
+	pc.mux.Lock()
+	defer pc.mux.Unlock()
+
+	pc.pending = true
+	return len(b), nil
+}
@@ -0,0 +1,66 @@
+package adapters
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	C "github.com/ClashrAuto/Clashr/constant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReject_Reset(t *testing.T) {
+	c, err := NewReject().DialContext(context.Background(), &C.Metadata{})
+	assert.Nil(t, err)
+
+	_, err = c.Read(make([]byte, 1))
+	assert.True(t, errors.Is(err, syscall.ECONNRESET))
+}
+
+func TestRejectDrop_Timeout(t *testing.T) {
+	r := NewRejectDrop()
+	r.timeout = 50 * time.Millisecond
+
+	c, err := r.DialContext(context.Background(), &C.Metadata{})
+	assert.Nil(t, err)
+	defer c.Close()
+
+	n, err := c.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 18, n)
+
+	start := time.Now()
+	_, err = c.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+}
+
+func TestRejectPage_HTTP(t *testing.T) {
+	r := NewRejectPage([]byte("blocked"))
+
+	c, err := r.DialContext(context.Background(), &C.Metadata{Type: C.HTTP})
+	assert.Nil(t, err)
+
+	reader := bufio.NewReader(c)
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		assert.Nil(t, req.Write(c))
+
+		resp, err := http.ReadResponse(reader, req)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		assert.Equal(t, "blocked", string(body))
+	}
+
+	c, err = r.DialContext(context.Background(), &C.Metadata{Type: C.HTTPCONNECT})
+	assert.Nil(t, err)
+	_, err = c.Read(make([]byte, 1))
+	assert.True(t, errors.Is(err, syscall.ECONNRESET))
+}
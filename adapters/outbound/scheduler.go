@@ -0,0 +1,226 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	C "github.com/ClashrAuto/Clashr/constant"
+)
+
+const (
+	defaultHealthCheckConcurrency = 10
+	schedulerTick                 = time.Second
+)
+
+// healthCheckScheduler is shared by all groups, so a proxy in several groups is not probed by each of them
+var healthCheckScheduler = NewScheduler(defaultHealthCheckConcurrency)
+
+// HealthCheck is the periodic checks a group registers to the Scheduler
+type HealthCheck struct {
+	Proxies []C.Proxy
+	Probe   *Probe
+	// Interval is the period of the checks, zero disables them after the first round
+	Interval time.Duration
+	// Idle suspends the periodic checks while it returns true (optional)
+	Idle func() bool
+	// OnChecked is called after each round of checks (optional)
+	OnChecked func()
+}
+
+// Registration is a HealthCheck registered to a Scheduler
+type Registration struct {
+	HealthCheck
+	scheduler *Scheduler
+	next      time.Time
+	running   int32
+}
+
+// Check probe all proxies of the registration now and wait for the results,
+// the proxies probed recently with the same probe are skipped.
+func (r *Registration) Check(ctx context.Context) {
+	if !atomic.CompareAndSwapInt32(&r.running, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&r.running, 0)
+
+	wg := sync.WaitGroup{}
+	for _, proxy := range r.Proxies {
+		wg.Add(1)
+		go func(proxy C.Proxy) {
+			defer wg.Done()
+			r.scheduler.check(ctx, proxy, r.Probe, r.Interval/2)
+		}(proxy)
+	}
+	wg.Wait()
+
+	if r.OnChecked != nil {
+		r.OnChecked()
+	}
+}
+
+// Close stop the periodic checks
+func (r *Registration) Close() {
+	r.scheduler.unregister(r)
+}
+
+type probeKey struct {
+	proxy C.Proxy
+	probe string
+}
+
+// flight is a running probe, identical probes wait for it instead of probing again
+type flight struct {
+	done chan struct{}
+}
+
+type probeState struct {
+	last   time.Time
+	flight *flight
+}
+
+// Scheduler run the health checks of all groups with bounded concurrency,
+// identical probes of a proxy are coalesced and the results are shared through Proxy.DelayHistory.
+type Scheduler struct {
+	sem chan struct{}
+
+	mux           sync.Mutex
+	registrations map[*Registration]struct{}
+	states        map[probeKey]*probeState
+	started       bool
+}
+
+// Register add hc to the scheduler, the first round starts immediately unless it is idle
+func (s *Scheduler) Register(hc HealthCheck) *Registration {
+	r := &Registration{HealthCheck: hc, scheduler: s, next: time.Now().Add(hc.Interval)}
+
+	s.mux.Lock()
+	s.registrations[r] = struct{}{}
+	if !s.started {
+		s.started = true
+		go s.loop()
+	}
+	s.mux.Unlock()
+
+	if hc.Idle == nil || !hc.Idle() {
+		go r.Check(context.Background())
+	}
+	return r
+}
+
+func (s *Scheduler) unregister(r *Registration) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delete(s.registrations, r)
+
+	// drop the states no longer used by any registration
+	used := map[C.Proxy]bool{}
+	for r := range s.registrations {
+		for _, proxy := range r.Proxies {
+			used[proxy] = true
+		}
+	}
+	for key, state := range s.states {
+		if !used[key.proxy] && state.flight == nil {
+			delete(s.states, key)
+		}
+	}
+}
+
+func (s *Scheduler) loop() {
+	tick := time.NewTicker(schedulerTick)
+	defer tick.Stop()
+
+	for now := range tick.C {
+		s.mux.Lock()
+		due := []*Registration{}
+		for r := range s.registrations {
+			if r.Interval <= 0 || now.Before(r.next) {
+				continue
+			}
+			r.next = now.Add(r.Interval)
+			if r.Idle == nil || !r.Idle() {
+				due = append(due, r)
+			}
+		}
+		s.mux.Unlock()
+
+		for _, r := range due {
+			go r.Check(context.Background())
+		}
+	}
+}
+
+// check probe proxy unless it was probed within fresh or is being probed by the same probe
+func (s *Scheduler) check(ctx context.Context, proxy C.Proxy, probe *Probe, fresh time.Duration) {
+	key := probeKey{proxy: proxy, probe: probe.key()}
+
+	s.mux.Lock()
+	state, ok := s.states[key]
+	if !ok {
+		state = &probeState{}
+		s.states[key] = state
+	}
+
+	if f := state.flight; f != nil {
+		s.mux.Unlock()
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+		}
+		return
+	}
+
+	if !state.last.IsZero() && time.Since(state.last) < fresh {
+		s.mux.Unlock()
+		return
+	}
+
+	f := &flight{done: make(chan struct{})}
+	state.flight = f
+	s.mux.Unlock()
+
+	probed := false
+	defer func() {
+		s.mux.Lock()
+		state.flight = nil
+		if probed {
+			state.last = time.Now()
+		}
+		s.mux.Unlock()
+		close(f.done)
+	}()
+
+	select {
+	case s.sem <- struct{}{}:
+		defer func() { <-s.sem }()
+	case <-ctx.Done():
+		return
+	}
+	probed = true
+
+	timeout := probe.Timeout
+	if timeout <= 0 {
+		timeout = defaultURLTestTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	check(ctx, proxy, probe)
+}
+
+// key identify the identical probes
+func (p *Probe) key() string {
+	return fmt.Sprintf("%s|%s|%s|%v|%s|%s", p.Type, p.URL, p.Method, p.ExpectedStatus, p.Timeout, p.DNSServer)
+}
+
+// NewScheduler return a Scheduler running at most concurrency probes at the same time
+func NewScheduler(concurrency int) *Scheduler {
+	return &Scheduler{
+		sem:           make(chan struct{}, concurrency),
+		registrations: map[*Registration]struct{}{},
+		states:        map[probeKey]*probeState{},
+	}
+}
@@ -0,0 +1,98 @@
+package adapters
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	C "github.com/ClashrAuto/Clashr/constant"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowProxy is a fakeProxy whose probes take a while, recording the peak of concurrent probes
+type slowProxy struct {
+	fakeProxy
+	running *int32
+	peak    *int32
+}
+
+func (s *slowProxy) URLTest(ctx context.Context, url string) (uint16, error) {
+	n := atomic.AddInt32(s.running, 1)
+	defer atomic.AddInt32(s.running, -1)
+	for {
+		peak := atomic.LoadInt32(s.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(s.peak, peak, n) {
+			break
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	return s.fakeProxy.URLTest(ctx, url)
+}
+
+func TestScheduler_Coalesce(t *testing.T) {
+	s := NewScheduler(10)
+	a, b := &fakeProxy{name: "a"}, &fakeProxy{name: "b"}
+	probe := &Probe{Type: ProbeHTTP, URL: "http://www.gstatic.com/generate_204"}
+
+	r1 := s.Register(HealthCheck{Proxies: []C.Proxy{a, b}, Probe: probe, Interval: time.Minute, Idle: func() bool { return true }})
+	defer r1.Close()
+	r2 := s.Register(HealthCheck{Proxies: []C.Proxy{a}, Probe: probe, Interval: time.Minute, Idle: func() bool { return true }})
+	defer r2.Close()
+
+	r1.Check(context.Background())
+	r2.Check(context.Background())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&a.tests))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&b.tests))
+
+	// a different probe is not coalesced
+	r3 := s.Register(HealthCheck{
+		Proxies:  []C.Proxy{a},
+		Probe:    &Probe{Type: ProbeTCPConnect, URL: probe.URL},
+		Interval: time.Minute,
+		Idle:     func() bool { return true },
+	})
+	defer r3.Close()
+	r3.Check(context.Background())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&a.tests))
+}
+
+func TestScheduler_Concurrency(t *testing.T) {
+	s := NewScheduler(2)
+	running, peak := new(int32), new(int32)
+
+	proxies := []C.Proxy{}
+	for i := 0; i < 6; i++ {
+		proxies = append(proxies, &slowProxy{running: running, peak: peak})
+	}
+
+	checked := make(chan struct{})
+	r := s.Register(HealthCheck{
+		Proxies:   proxies,
+		Probe:     &Probe{Type: ProbeHTTP, URL: "http://www.gstatic.com/generate_204"},
+		Interval:  time.Minute,
+		OnChecked: func() { close(checked) },
+	})
+	defer r.Close()
+
+	select {
+	case <-checked:
+	case <-time.After(time.Second):
+		assert.FailNow(t, "health check timeout")
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(peak))
+}
+
+func TestScheduler_ZeroInterval(t *testing.T) {
+	s := NewScheduler(10)
+	a := &fakeProxy{name: "a"}
+	probe := &Probe{Type: ProbeHTTP, URL: "http://www.gstatic.com/generate_204"}
+
+	r := s.Register(HealthCheck{Proxies: []C.Proxy{a}, Probe: probe})
+	defer r.Close()
+
+	// only the first round runs
+	time.Sleep(schedulerTick*2 + 100*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&a.tests))
+}
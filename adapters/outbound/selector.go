@@ -49,6 +49,14 @@ func (s *Selector) MarshalJSON() ([]byte, error) {
 	})
 }
 
+func (s *Selector) Proxies() []C.Proxy {
+	proxies := make([]C.Proxy, len(s.proxyList))
+	for idx, name := range s.proxyList {
+		proxies[idx] = s.proxies[name]
+	}
+	return proxies
+}
+
 func (s *Selector) Now() string {
 	return s.selected.Name()
 }
@@ -9,8 +9,12 @@ import (
 	"strconv"
 
 	"github.com/ClashrAuto/Clashr/common/structure"
+	"github.com/ClashrAuto/Clashr/component/dialer"
+	"github.com/ClashrAuto/Clashr/component/mux"
 	obfs "github.com/ClashrAuto/Clashr/component/simple-obfs"
+	"github.com/ClashrAuto/Clashr/component/sip003"
 	"github.com/ClashrAuto/Clashr/component/socks5"
+	"github.com/ClashrAuto/Clashr/component/ss2022"
 	v2rayObfs "github.com/ClashrAuto/Clashr/component/v2ray-plugin"
 	C "github.com/ClashrAuto/Clashr/constant"
 
@@ -26,9 +30,14 @@ type ShadowSocks struct {
 	obfsMode    string
 	obfsOption  *simpleObfsOption
 	v2rayOption *v2rayObfs.Option
+	muxClient   *mux.Client
+
+	// external SIP003 plugin
+	plugin *sip003.Plugin
 }
 
 type ShadowSocksOption struct {
+	BasicOption
 	Name       string                 `proxy:"name"`
 	Server     string                 `proxy:"server"`
 	Port       int                    `proxy:"port"`
@@ -49,17 +58,27 @@ type simpleObfsOption struct {
 }
 
 type v2rayObfsOption struct {
-	Mode           string            `obfs:"mode"`
-	Host           string            `obfs:"host,omitempty"`
-	Path           string            `obfs:"path,omitempty"`
-	TLS            bool              `obfs:"tls,omitempty"`
-	Headers        map[string]string `obfs:"headers,omitempty"`
-	SkipCertVerify bool              `obfs:"skip-cert-verify,omitempty"`
-	Mux            bool              `obfs:"mux,omitempty"`
+	Mode           string                 `obfs:"mode"`
+	Host           string                 `obfs:"host,omitempty"`
+	Path           string                 `obfs:"path,omitempty"`
+	TLS            bool                   `obfs:"tls,omitempty"`
+	Headers        map[string]string      `obfs:"headers,omitempty"`
+	SkipCertVerify bool                   `obfs:"skip-cert-verify,omitempty"`
+	Mux            bool                   `obfs:"mux,omitempty"`
+	MuxConcurrency int                    `obfs:"mux-concurrency,omitempty"`
+	TLSOpts        map[string]interface{} `obfs:"tls-opts,omitempty"`
 }
 
-func (ss *ShadowSocks) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
-	c, err := dialContext(ctx, "tcp", ss.server)
+// dialServer establish a connection to the server with plugin and obfs
+func (ss *ShadowSocks) dialServer(ctx context.Context) (net.Conn, error) {
+	var c net.Conn
+	var err error
+	if ss.plugin != nil {
+		// the plugin listens on loopback, socket options are not applied to it
+		c, err = (&net.Dialer{}).DialContext(ctx, "tcp", ss.plugin.Addr())
+	} else {
+		c, err = dialContext(ctx, "tcp", ss.server, ss.sockopt)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("%s connect error: %s", ss.server, err.Error())
 	}
@@ -77,13 +96,32 @@ func (ss *ShadowSocks) DialContext(ctx context.Context, metadata *C.Metadata) (C
 			return nil, fmt.Errorf("%s connect error: %s", ss.server, err.Error())
 		}
 	}
+	return c, nil
+}
+
+func (ss *ShadowSocks) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
+	var c net.Conn
+	var err error
+	if ss.muxClient != nil {
+		// v2ray-plugin forwards every stream to the ss server, the destination is ignored
+		c, err = ss.muxClient.DialContext(ctx, "tcp", "127.0.0.1", 0)
+		if err != nil {
+			err = fmt.Errorf("%s connect error: %s", ss.server, err.Error())
+		}
+	} else {
+		c, err = ss.dialServer(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	c = ss.cipher.StreamConn(c)
 	_, err = c.Write(serializesSocksAddr(metadata))
 	return newConn(c, ss), err
 }
 
 func (ss *ShadowSocks) DialUDP(metadata *C.Metadata) (C.PacketConn, net.Addr, error) {
-	pc, err := net.ListenPacket("udp", "")
+	pc, err := dialer.ListenPacket("udp", "", ss.sockopt)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -102,6 +140,15 @@ func (ss *ShadowSocks) DialUDP(metadata *C.Metadata) (C.PacketConn, net.Addr, er
 	return newPacketConn(&ssUDPConn{PacketConn: pc, rAddr: targetAddr}, ss), addr, nil
 }
 
+func (ss *ShadowSocks) Destroy() {
+	if ss.plugin != nil {
+		ss.plugin.Close()
+	}
+	if ss.muxClient != nil {
+		ss.muxClient.Close()
+	}
+}
+
 func (ss *ShadowSocks) MarshalJSON() ([]byte, error) {
 	return json.Marshal(map[string]string{
 		"type": ss.Type().String(),
@@ -112,13 +159,21 @@ func NewShadowSocks(option ShadowSocksOption) (*ShadowSocks, error) {
 	server := net.JoinHostPort(option.Server, strconv.Itoa(option.Port))
 	cipher := option.Cipher
 	password := option.Password
-	ciph, err := core.PickCipher(cipher, nil, password)
+	var ciph core.Cipher
+	var err error
+	if ss2022.IsSupported(cipher) {
+		ciph, err = ss2022.New(cipher, password)
+	} else {
+		ciph, err = core.PickCipher(cipher, nil, password)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("ss %s initialize error: %s", server, err.Error())
 	}
 
 	var v2rayOption *v2rayObfs.Option
 	var obfsOption *simpleObfsOption
+	var plugin *sip003.Plugin
+	var muxOption *mux.Option
 	obfsMode := ""
 
 	// forward compatibility before 1.0
@@ -157,10 +212,9 @@ func NewShadowSocks(option ShadowSocksOption) (*ShadowSocks, error) {
 
 		var tlsConfig *tls.Config
 		if opts.TLS {
-			tlsConfig = &tls.Config{
-				ServerName:         opts.Host,
-				InsecureSkipVerify: opts.SkipCertVerify,
-				ClientSessionCache: getClientSessionCache(),
+			tlsConfig, err = newTLSConfig(opts.TLSOpts, opts.Host, opts.SkipCertVerify)
+			if err != nil {
+				return nil, fmt.Errorf("ss %s initialize v2ray-plugin tls error: %s", server, err.Error())
 			}
 		}
 		v2rayOption = &v2rayObfs.Option{
@@ -168,15 +222,31 @@ func NewShadowSocks(option ShadowSocksOption) (*ShadowSocks, error) {
 			Path:      opts.Path,
 			Headers:   opts.Headers,
 			TLSConfig: tlsConfig,
-			Mux:       opts.Mux,
 		}
+
+		if opts.Mux {
+			muxOption = &mux.Option{Concurrency: opts.MuxConcurrency}
+		}
+	} else if option.Plugin != "" {
+		// any other plugin is treated as an external SIP003 plugin binary
+		p, err := sip003.New(sip003.Option{
+			Path:       option.Plugin,
+			Options:    sip003.EncodeOptions(option.PluginOpts),
+			RemoteHost: option.Server,
+			RemotePort: strconv.Itoa(option.Port),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("ss %s initialize plugin error: %s", server, err.Error())
+		}
+		plugin = p
 	}
 
-	return &ShadowSocks{
+	ss := &ShadowSocks{
 		Base: &Base{
-			name: option.Name,
-			tp:   C.Shadowsocks,
-			udp:  option.UDP,
+			name:    option.Name,
+			tp:      C.Shadowsocks,
+			udp:     option.UDP,
+			sockopt: option.socketOption(),
 		},
 		server: server,
 		cipher: ciph,
@@ -184,7 +254,13 @@ func NewShadowSocks(option ShadowSocksOption) (*ShadowSocks, error) {
 		obfsMode:    obfsMode,
 		v2rayOption: v2rayOption,
 		obfsOption:  obfsOption,
-	}, nil
+		plugin:      plugin,
+	}
+
+	if muxOption != nil {
+		ss.muxClient = mux.NewClient(ss.dialServer, *muxOption)
+	}
+	return ss, nil
 }
 
 type ssUDPConn struct {
@@ -25,6 +25,7 @@ type ShadowsocksR struct {
 }
 
 type ShadowsocksROption struct {
+	BasicOption
 	Name          string `proxy:"name"`
 	Server        string `proxy:"server"`
 	Port          int    `proxy:"port"`
@@ -43,7 +44,7 @@ func (ssrins *ShadowsocksR) DialContext(ctx context.Context, metadata *C.Metadat
 		return nil, err
 	}
 
-	conn, err := dialContext(ctx, "tcp", ssrins.server)
+	conn, err := dialContext(ctx, "tcp", ssrins.server, ssrins.sockopt)
 	if err != nil {
 		return nil, err
 	}
@@ -108,9 +109,10 @@ func NewShadowsocksR(ssrop ShadowsocksROption) (*ShadowsocksR, error) {
 	server := net.JoinHostPort(ssrop.Server, strconv.Itoa(ssrop.Port))
 	return &ShadowsocksR{
 		Base: &Base{
-			name: ssrop.Name,
-			tp:   C.ShadowsocksR,
-			udp:  false,
+			name:    ssrop.Name,
+			tp:      C.ShadowsocksR,
+			udp:     false,
+			sockopt: ssrop.socketOption(),
 		},
 		server: server,
 		//ssrquery: u,
@@ -20,6 +20,7 @@ type Snell struct {
 }
 
 type SnellOption struct {
+	BasicOption
 	Name     string                 `proxy:"name"`
 	Server   string                 `proxy:"server"`
 	Port     int                    `proxy:"port"`
@@ -28,7 +29,7 @@ type SnellOption struct {
 }
 
 func (s *Snell) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
-	c, err := dialContext(ctx, "tcp", s.server)
+	c, err := dialContext(ctx, "tcp", s.server, s.sockopt)
 	if err != nil {
 		return nil, fmt.Errorf("%s connect error: %s", s.server, err.Error())
 	}
@@ -62,8 +63,9 @@ func NewSnell(option SnellOption) (*Snell, error) {
 
 	return &Snell{
 		Base: &Base{
-			name: option.Name,
-			tp:   C.Snell,
+			name:    option.Name,
+			tp:      C.Snell,
+			sockopt: option.socketOption(),
 		},
 		server:     server,
 		psk:        psk,
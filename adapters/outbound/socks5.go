@@ -9,6 +9,7 @@ import (
 	"net"
 	"strconv"
 
+	"github.com/ClashrAuto/Clashr/component/dialer"
 	"github.com/ClashrAuto/Clashr/component/socks5"
 	C "github.com/ClashrAuto/Clashr/constant"
 )
@@ -24,18 +25,20 @@ type Socks5 struct {
 }
 
 type Socks5Option struct {
-	Name           string `proxy:"name"`
-	Server         string `proxy:"server"`
-	Port           int    `proxy:"port"`
-	UserName       string `proxy:"username,omitempty"`
-	Password       string `proxy:"password,omitempty"`
-	TLS            bool   `proxy:"tls,omitempty"`
-	UDP            bool   `proxy:"udp,omitempty"`
-	SkipCertVerify bool   `proxy:"skip-cert-verify,omitempty"`
+	BasicOption
+	Name           string                 `proxy:"name"`
+	Server         string                 `proxy:"server"`
+	Port           int                    `proxy:"port"`
+	UserName       string                 `proxy:"username,omitempty"`
+	Password       string                 `proxy:"password,omitempty"`
+	TLS            bool                   `proxy:"tls,omitempty"`
+	UDP            bool                   `proxy:"udp,omitempty"`
+	SkipCertVerify bool                   `proxy:"skip-cert-verify,omitempty"`
+	TLSOpts        map[string]interface{} `proxy:"tls-opts,omitempty"`
 }
 
 func (ss *Socks5) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
-	c, err := dialContext(ctx, "tcp", ss.addr)
+	c, err := dialContext(ctx, "tcp", ss.addr, ss.sockopt)
 
 	if err == nil && ss.tls {
 		cc := tls.Client(c, ss.tlsConfig)
@@ -63,7 +66,7 @@ func (ss *Socks5) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn
 func (ss *Socks5) DialUDP(metadata *C.Metadata) (_ C.PacketConn, _ net.Addr, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), tcpTimeout)
 	defer cancel()
-	c, err := dialContext(ctx, "tcp", ss.addr)
+	c, err := dialContext(ctx, "tcp", ss.addr, ss.sockopt)
 	if err != nil {
 		err = fmt.Errorf("%s connect error", ss.addr)
 		return
@@ -106,7 +109,7 @@ func (ss *Socks5) DialUDP(metadata *C.Metadata) (_ C.PacketConn, _ net.Addr, err
 		return nil, nil, fmt.Errorf("parse address error: %v:%v", metadata.String(), metadata.DstPort)
 	}
 
-	pc, err := net.ListenPacket("udp", "")
+	pc, err := dialer.ListenPacket("udp", "", ss.sockopt)
 	if err != nil {
 		return
 	}
@@ -122,21 +125,22 @@ func (ss *Socks5) DialUDP(metadata *C.Metadata) (_ C.PacketConn, _ net.Addr, err
 	return newPacketConn(&socksUDPConn{PacketConn: pc, rAddr: targetAddr, tcpConn: c}, ss), addr, nil
 }
 
-func NewSocks5(option Socks5Option) *Socks5 {
+func NewSocks5(option Socks5Option) (*Socks5, error) {
 	var tlsConfig *tls.Config
 	if option.TLS {
-		tlsConfig = &tls.Config{
-			InsecureSkipVerify: option.SkipCertVerify,
-			ClientSessionCache: getClientSessionCache(),
-			ServerName:         option.Server,
+		var err error
+		tlsConfig, err = newTLSConfig(option.TLSOpts, option.Server, option.SkipCertVerify)
+		if err != nil {
+			return nil, fmt.Errorf("socks5 %s initialize tls error: %s", net.JoinHostPort(option.Server, strconv.Itoa(option.Port)), err.Error())
 		}
 	}
 
 	return &Socks5{
 		Base: &Base{
-			name: option.Name,
-			tp:   C.Socks5,
-			udp:  option.UDP,
+			name:    option.Name,
+			tp:      C.Socks5,
+			udp:     option.UDP,
+			sockopt: option.socketOption(),
 		},
 		addr:           net.JoinHostPort(option.Server, strconv.Itoa(option.Port)),
 		user:           option.UserName,
@@ -144,7 +148,7 @@ func NewSocks5(option Socks5Option) *Socks5 {
 		tls:            option.TLS,
 		skipCertVerify: option.SkipCertVerify,
 		tlsConfig:      tlsConfig,
-	}
+	}, nil
 }
 
 type socksUDPConn struct {
@@ -0,0 +1,136 @@
+package adapters
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/ClashrAuto/Clashr/common/structure"
+	C "github.com/ClashrAuto/Clashr/constant"
+)
+
+var tlsVersions = map[string]uint16{
+	// an unquoted 1.0 in yaml is decoded as 1
+	"1":   tls.VersionTLS10,
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSOption is the tls-opts block shared by the proxies supporting tls
+type TLSOption struct {
+	SNI         string   `tls:"sni,omitempty"`
+	ALPN        []string `tls:"alpn,omitempty"`
+	CA          string   `tls:"ca,omitempty"`
+	Fingerprint string   `tls:"fingerprint,omitempty"`
+	Certificate string   `tls:"certificate,omitempty"`
+	PrivateKey  string   `tls:"private-key,omitempty"`
+	MinVersion  string   `tls:"min-version,omitempty"`
+	MaxVersion  string   `tls:"max-version,omitempty"`
+}
+
+// resolvePath return path relative to the configuration directory
+func resolvePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(C.Path.HomeDir(), path)
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("unsupported tls version: %s", version)
+	}
+	return v, nil
+}
+
+// verifyFingerprint accept the peer if the sha256 of its leaf certificate is fingerprint,
+// it runs on the resumed sessions as well
+func verifyFingerprint(fingerprint []byte) func(cs tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("no certificate from server")
+		}
+
+		sum := sha256.Sum256(cs.PeerCertificates[0].Raw)
+		if !bytes.Equal(sum[:], fingerprint) {
+			return fmt.Errorf("certificate fingerprint mismatch: %s", hex.EncodeToString(sum[:]))
+		}
+		return nil
+	}
+}
+
+// newTLSConfig build a tls.Config with tls-opts, serverName is used when sni is not set
+func newTLSConfig(opts map[string]interface{}, serverName string, skipCertVerify bool) (*tls.Config, error) {
+	option := &TLSOption{}
+	decoder := structure.NewDecoder(structure.Option{TagName: "tls", WeaklyTypedInput: true})
+	if err := decoder.Decode(opts, option); err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: skipCertVerify,
+		ClientSessionCache: getClientSessionCache(),
+		NextProtos:         option.ALPN,
+	}
+
+	if option.SNI != "" {
+		tlsConfig.ServerName = option.SNI
+	}
+
+	var err error
+	if tlsConfig.MinVersion, err = parseTLSVersion(option.MinVersion); err != nil {
+		return nil, err
+	}
+	if tlsConfig.MaxVersion, err = parseTLSVersion(option.MaxVersion); err != nil {
+		return nil, err
+	}
+
+	if option.CA != "" {
+		buf, err := ioutil.ReadFile(resolvePath(option.CA))
+		if err != nil {
+			return nil, fmt.Errorf("load ca error: %s", err.Error())
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buf) {
+			return nil, fmt.Errorf("no certificate found in %s", option.CA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if option.Certificate != "" || option.PrivateKey != "" {
+		cert, err := tls.LoadX509KeyPair(resolvePath(option.Certificate), resolvePath(option.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate error: %s", err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if option.Fingerprint != "" {
+		fingerprint, err := hex.DecodeString(strings.Replace(option.Fingerprint, ":", "", -1))
+		if err != nil || len(fingerprint) != sha256.Size {
+			return nil, fmt.Errorf("fingerprint must be a sha256 hex string: %s", option.Fingerprint)
+		}
+
+		// the pinned certificate replaces the chain verification, so self-signed certificates work
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = verifyFingerprint(fingerprint)
+	}
+
+	return tlsConfig, nil
+}
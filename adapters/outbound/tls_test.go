@@ -0,0 +1,79 @@
+package adapters
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTLSConfig_Fingerprint(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	sum := sha256.Sum256(server.Certificate().Raw)
+	tlsConfig, err := newTLSConfig(map[string]interface{}{
+		"fingerprint": hex.EncodeToString(sum[:]),
+	}, "example.com", false)
+	assert.Nil(t, err)
+
+	conn, err := tls.Dial("tcp", server.Listener.Addr().String(), tlsConfig)
+	assert.Nil(t, err)
+	if conn != nil {
+		conn.Close()
+	}
+
+	tlsConfig, err = newTLSConfig(map[string]interface{}{
+		"fingerprint": hex.EncodeToString(make([]byte, sha256.Size)),
+	}, "example.com", false)
+	assert.Nil(t, err)
+
+	_, err = tls.Dial("tcp", server.Listener.Addr().String(), tlsConfig)
+	assert.Error(t, err)
+}
+
+func TestNewTLSConfig_FingerprintResumption(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// a session of the shared cache without pinning
+	tlsConfig, err := newTLSConfig(map[string]interface{}{"max-version": "1.2"}, "resumption.example.com", true)
+	assert.Nil(t, err)
+	conn, err := tls.Dial("tcp", server.Listener.Addr().String(), tlsConfig)
+	assert.Nil(t, err)
+	conn.Close()
+
+	tlsConfig, err = newTLSConfig(map[string]interface{}{
+		"max-version": "1.2",
+		"fingerprint": hex.EncodeToString(make([]byte, sha256.Size)),
+	}, "resumption.example.com", false)
+	assert.Nil(t, err)
+
+	_, err = tls.Dial("tcp", server.Listener.Addr().String(), tlsConfig)
+	assert.Error(t, err)
+}
+
+func TestNewTLSConfig_Options(t *testing.T) {
+	tlsConfig, err := newTLSConfig(map[string]interface{}{
+		"sni":         "relay.example.com",
+		"alpn":        []interface{}{"h2", "http/1.1"},
+		"min-version": "1.2",
+		"max-version": 1.3,
+	}, "example.com", false)
+	assert.Nil(t, err)
+	assert.Equal(t, "relay.example.com", tlsConfig.ServerName)
+	assert.Equal(t, []string{"h2", "http/1.1"}, tlsConfig.NextProtos)
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MaxVersion)
+	assert.NotNil(t, tlsConfig.ClientSessionCache)
+
+	_, err = newTLSConfig(map[string]interface{}{"fingerprint": "xx"}, "example.com", false)
+	assert.Error(t, err)
+
+	_, err = newTLSConfig(map[string]interface{}{"min-version": "1.4"}, "example.com", false)
+	assert.Error(t, err)
+}
@@ -8,25 +8,30 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/ClashrAuto/Clashr/common/picker"
 	C "github.com/ClashrAuto/Clashr/constant"
 )
 
 type URLTest struct {
 	*Base
-	proxies  []C.Proxy
-	rawURL   string
-	fast     C.Proxy
-	interval time.Duration
-	done     chan struct{}
-	once     int32
+	proxies     []C.Proxy
+	fast        C.Proxy
+	interval    time.Duration
+	tolerance   uint16
+	lazy        bool
+	lastDial    int64
+	healthCheck *Registration
 }
 
 type URLTestOption struct {
-	Name     string   `proxy:"name"`
-	Proxies  []string `proxy:"proxies"`
-	URL      string   `proxy:"url"`
-	Interval int      `proxy:"interval"`
+	Name      string   `proxy:"name"`
+	Proxies   []string `proxy:"proxies"`
+	URL       string   `proxy:"url"`
+	Interval  int      `proxy:"interval"`
+	Tolerance int      `proxy:"tolerance,omitempty"`
+	Timeout   int      `proxy:"timeout,omitempty"`
+	Lazy      bool     `proxy:"lazy,omitempty"`
+
+	HealthCheck map[string]interface{} `proxy:"health-check,omitempty"`
 }
 
 func (u *URLTest) Now() string {
@@ -34,6 +39,7 @@ func (u *URLTest) Now() string {
 }
 
 func (u *URLTest) DialContext(ctx context.Context, metadata *C.Metadata) (c C.Conn, err error) {
+	u.touch()
 	for i := 0; i < 3; i++ {
 		c, err = u.fast.DialContext(ctx, metadata)
 		if err == nil {
@@ -46,6 +52,7 @@ func (u *URLTest) DialContext(ctx context.Context, metadata *C.Metadata) (c C.Co
 }
 
 func (u *URLTest) DialUDP(metadata *C.Metadata) (C.PacketConn, net.Addr, error) {
+	u.touch()
 	pc, addr, err := u.fast.DialUDP(metadata)
 	if err == nil {
 		pc.AppendToChains(u)
@@ -57,6 +64,10 @@ func (u *URLTest) SupportUDP() bool {
 	return u.fast.SupportUDP()
 }
 
+func (u *URLTest) Proxies() []C.Proxy {
+	return u.proxies
+}
+
 func (u *URLTest) MarshalJSON() ([]byte, error) {
 	var all []string
 	for _, proxy := range u.proxies {
@@ -70,69 +81,59 @@ func (u *URLTest) MarshalJSON() ([]byte, error) {
 }
 
 func (u *URLTest) Destroy() {
-	u.done <- struct{}{}
+	u.healthCheck.Close()
 }
 
-func (u *URLTest) loop() {
-	tick := time.NewTicker(u.interval)
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	go u.speedTest(ctx)
-Loop:
-	for {
-		select {
-		case <-tick.C:
-			go u.speedTest(ctx)
-		case <-u.done:
-			break Loop
-		}
+// touch record the dial, a suspended lazy group is woken up to probe immediately
+func (u *URLTest) touch() {
+	now := time.Now().UnixNano()
+	last := atomic.SwapInt64(&u.lastDial, now)
+	if u.lazy && u.interval > 0 && time.Duration(now-last) > u.interval {
+		go u.healthCheck.Check(context.Background())
 	}
 }
 
-func (u *URLTest) fallback() {
-	fast := u.proxies[0]
-	min := fast.LastDelay()
-	for _, proxy := range u.proxies[1:] {
+// idle return true if a lazy group has not been dialed during the last interval
+func (u *URLTest) idle() bool {
+	if !u.lazy {
+		return false
+	}
+	last := atomic.LoadInt64(&u.lastDial)
+	return time.Since(time.Unix(0, last)) > u.interval
+}
+
+// fastest return the alive proxy with the lowest delay, or proxies[0] if all are dead
+func (u *URLTest) fastest() C.Proxy {
+	var fast C.Proxy
+	for _, proxy := range u.proxies {
 		if !proxy.Alive() {
 			continue
 		}
 
-		delay := proxy.LastDelay()
-		if delay < min {
+		if fast == nil || proxy.LastDelay() < fast.LastDelay() {
 			fast = proxy
-			min = delay
 		}
 	}
-	u.fast = fast
-}
 
-func (u *URLTest) speedTest(ctx context.Context) {
-	if !atomic.CompareAndSwapInt32(&u.once, 0, 1) {
-		return
-	}
-	defer atomic.StoreInt32(&u.once, 0)
-
-	ctx, cancel := context.WithTimeout(ctx, defaultURLTestTimeout)
-	defer cancel()
-	picker := picker.WithoutAutoCancel(ctx)
-	for _, p := range u.proxies {
-		proxy := p
-		picker.Go(func() (interface{}, error) {
-			_, err := proxy.URLTest(ctx, u.rawURL)
-			if err != nil {
-				return nil, err
-			}
-			return proxy, nil
-		})
+	if fast == nil {
+		return u.proxies[0]
 	}
+	return fast
+}
 
-	fast := picker.WaitWithoutCancel()
-	if fast != nil {
-		u.fast = fast.(C.Proxy)
-	}
+func (u *URLTest) fallback() {
+	u.fast = u.fastest()
+}
 
-	picker.Wait()
+// onChecked pick the fastest proxy after each round of health checks
+func (u *URLTest) onChecked() {
+	// only switch when the new one is faster than the current one by tolerance,
+	// so long-lived connections are not churned by jitters
+	fast := u.fastest()
+	current := u.fast
+	if !current.Alive() || int(fast.LastDelay())+int(u.tolerance) < int(current.LastDelay()) {
+		u.fast = fast
+	}
 }
 
 func NewURLTest(option URLTestOption, proxies []C.Proxy) (*URLTest, error) {
@@ -143,6 +144,17 @@ func NewURLTest(option URLTestOption, proxies []C.Proxy) (*URLTest, error) {
 	if len(proxies) < 1 {
 		return nil, errors.New("The number of proxies cannot be 0")
 	}
+	probe, err := newProbe(option.URL, option.HealthCheck)
+	if err != nil {
+		return nil, err
+	}
+	if option.Tolerance < 0 || option.Tolerance > 0xffff {
+		return nil, errors.New("tolerance must be between 0 and 65535")
+	}
+
+	if option.Timeout > 0 && probe.Timeout == 0 {
+		probe.Timeout = time.Duration(option.Timeout) * time.Millisecond
+	}
 
 	interval := time.Duration(option.Interval) * time.Second
 	urlTest := &URLTest{
@@ -150,13 +162,18 @@ func NewURLTest(option URLTestOption, proxies []C.Proxy) (*URLTest, error) {
 			name: option.Name,
 			tp:   C.URLTest,
 		},
-		proxies:  proxies[:],
-		rawURL:   option.URL,
-		fast:     proxies[0],
-		interval: interval,
-		done:     make(chan struct{}),
-		once:     0,
+		proxies:   proxies[:],
+		fast:      proxies[0],
+		interval:  interval,
+		tolerance: uint16(option.Tolerance),
+		lazy:      option.Lazy,
 	}
-	go urlTest.loop()
+	urlTest.healthCheck = healthCheckScheduler.Register(HealthCheck{
+		Proxies:   urlTest.proxies,
+		Probe:     probe,
+		Interval:  interval,
+		Idle:      urlTest.idle,
+		OnChecked: urlTest.onChecked,
+	})
 	return urlTest, nil
 }
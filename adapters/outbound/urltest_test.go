@@ -0,0 +1,84 @@
+package adapters
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	C "github.com/ClashrAuto/Clashr/constant"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeProxy is a C.Proxy reporting a fixed delay
+type fakeProxy struct {
+	C.ProxyAdapter
+	name  string
+	delay uint32
+	tests int32
+}
+
+func (f *fakeProxy) Name() string                     { return f.name }
+func (f *fakeProxy) Alive() bool                      { return f.LastDelay() != 0xffff }
+func (f *fakeProxy) LastDelay() uint16                { return uint16(atomic.LoadUint32(&f.delay)) }
+func (f *fakeProxy) DelayHistory() []C.DelayHistory   { return nil }
+func (f *fakeProxy) Dial(*C.Metadata) (C.Conn, error) { return nil, nil }
+
+func (f *fakeProxy) URLTest(ctx context.Context, url string) (uint16, error) {
+	atomic.AddInt32(&f.tests, 1)
+	return f.LastDelay(), nil
+}
+
+func (f *fakeProxy) setDelay(delay uint16) {
+	atomic.StoreUint32(&f.delay, uint32(delay))
+}
+
+func newTestURLTest(t *testing.T, option URLTestOption, proxies ...C.Proxy) *URLTest {
+	option.Name = "auto"
+	option.URL = "http://www.gstatic.com/generate_204"
+	if option.Interval == 0 {
+		option.Interval = 300
+	}
+
+	u, err := NewURLTest(option, proxies)
+	assert.Nil(t, err)
+	return u
+}
+
+func TestURLTest_Tolerance(t *testing.T) {
+	a := &fakeProxy{name: "a", delay: 100}
+	b := &fakeProxy{name: "b", delay: 90}
+	u := newTestURLTest(t, URLTestOption{Tolerance: 50}, a, b)
+	defer u.Destroy()
+
+	u.onChecked()
+	assert.Equal(t, "a", u.Now())
+
+	b.setDelay(40)
+	u.onChecked()
+	assert.Equal(t, "b", u.Now())
+
+	// the current one is dead, switch regardless of the tolerance
+	a.setDelay(30)
+	b.setDelay(0xffff)
+	u.onChecked()
+	assert.Equal(t, "a", u.Now())
+}
+
+func TestURLTest_Lazy(t *testing.T) {
+	a := &fakeProxy{name: "a", delay: 100}
+	u := newTestURLTest(t, URLTestOption{Lazy: true}, a)
+	defer u.Destroy()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&a.tests))
+
+	u.touch()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&a.tests))
+
+	// used recently, no extra probe
+	u.touch()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&a.tests))
+}
@@ -11,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ClashrAuto/Clashr/component/dialer"
 	"github.com/ClashrAuto/Clashr/component/socks5"
 	C "github.com/ClashrAuto/Clashr/constant"
 	"github.com/ClashrAuto/Clashr/dns"
@@ -18,6 +19,10 @@ import (
 
 const (
 	tcpTimeout = 5 * time.Second
+
+	// see RFC 8305 section 3 and 5
+	resolutionDelay        = 50 * time.Millisecond
+	connectionAttemptDelay = 250 * time.Millisecond
 )
 
 var (
@@ -86,83 +91,217 @@ func serializesSocksAddr(metadata *C.Metadata) []byte {
 	return bytes.Join(buf, nil)
 }
 
-func dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+// dialContext dial address with the socket options opt,
+// the global options are used when opt is nil.
+func dialContext(ctx context.Context, network, address string, opt *dialer.Option) (net.Conn, error) {
 	host, port, err := net.SplitHostPort(address)
 	if err != nil {
 		return nil, err
 	}
 
-	dialer := net.Dialer{}
+	version := dialer.GetIPVersion()
+	if ip := net.ParseIP(host); ip != nil {
+		if (version == dialer.IPv4Only && ip.To4() == nil) || (version == dialer.IPv6Only && ip.To4() != nil) {
+			return nil, fmt.Errorf("%s does not match ip-version %s", host, version.String())
+		}
+		return dialer.DialContext(ctx, network, address, opt)
+	}
+
+	switch version {
+	case dialer.IPv4Only:
+		ip, err := dns.ResolveIPv4(host)
+		if err != nil {
+			return nil, err
+		}
+		return dialer.DialContext(ctx, "tcp4", net.JoinHostPort(ip.String(), port), opt)
+	case dialer.IPv6Only:
+		ip, err := dns.ResolveIPv6(host)
+		if err != nil {
+			return nil, err
+		}
+		return dialer.DialContext(ctx, "tcp6", net.JoinHostPort(ip.String(), port), opt)
+	}
+
+	return dualStackDialContext(ctx, host, port, version == dialer.PreferIPv6, opt)
+}
+
+// dualStackDialContext implements Happy Eyeballs (RFC 8305) with the dns of clash and opt
+func dualStackDialContext(ctx context.Context, host, port string, preferIPv6 bool, opt *dialer.Option) (net.Conn, error) {
+	h := &happyEyeballs{
+		lookupIPv4: dns.ResolveAllIPv4,
+		lookupIPv6: dns.ResolveAllIPv6,
+		dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, address, opt)
+		},
+	}
+	return h.dialContext(ctx, host, port, preferIPv6)
+}
+
+// happyEyeballs is the lookups and the dial used by Happy Eyeballs
+type happyEyeballs struct {
+	lookupIPv4 func(host string) ([]net.IP, error)
+	lookupIPv6 func(host string) ([]net.IP, error)
+	dial       func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// dialContext resolve A and AAAA concurrently, the preferred family is waited for resolutionDelay,
+// then the addresses of both families are attempted alternately every connectionAttemptDelay,
+// starting with the preferred family. The first established connection wins and the others are canceled.
+func (h *happyEyeballs) dialContext(ctx context.Context, host, port string, preferIPv6 bool) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	returned := make(chan struct{})
 	defer close(returned)
 
+	type resolveResult struct {
+		ips  []net.IP
+		ipv6 bool
+		error
+	}
+	resolved := make(chan resolveResult, 2)
+	resolve := func(ipv6 bool) {
+		result := resolveResult{ipv6: ipv6}
+		if ipv6 {
+			result.ips, result.error = h.lookupIPv6(host)
+		} else {
+			result.ips, result.error = h.lookupIPv4(host)
+		}
+		resolved <- result
+	}
+	go resolve(false)
+	go resolve(true)
+
 	type dialResult struct {
 		net.Conn
 		error
-		resolved bool
-		ipv6     bool
-		done     bool
 	}
 	results := make(chan dialResult)
-	var primary, fallback dialResult
-
-	startRacer := func(ctx context.Context, host string, ipv6 bool) {
-		result := dialResult{ipv6: ipv6, done: true}
-		defer func() {
-			select {
-			case results <- result:
-			case <-returned:
-				if result.Conn != nil {
-					result.Conn.Close()
-				}
+	dial := func(ip net.IP) {
+		network := "tcp4"
+		if ip.To4() == nil {
+			network = "tcp6"
+		}
+
+		result := dialResult{}
+		result.Conn, result.error = h.dial(ctx, network, net.JoinHostPort(ip.String(), port))
+		select {
+		case results <- result:
+		case <-returned:
+			if result.Conn != nil {
+				result.Conn.Close()
 			}
-		}()
+		}
+	}
+
+	var (
+		// the resolved addresses not attempted yet, by family
+		preferred     []net.IP
+		other         []net.IP
+		lastPreferred bool
+		resolving     = 2
+		attempts      = 0
+		inflight      = 0
+		resolveErr    error
+		dialErr       error
+		delay         <-chan time.Time
+	)
 
+	// next pick the address of the other family than the last attempt, if there is one
+	next := func() net.IP {
 		var ip net.IP
-		if ipv6 {
-			ip, result.error = dns.ResolveIPv6(host)
+		if len(preferred) != 0 && (!lastPreferred || len(other) == 0) {
+			ip, preferred = preferred[0], preferred[1:]
+			lastPreferred = true
 		} else {
-			ip, result.error = dns.ResolveIPv4(host)
+			ip, other = other[0], other[1:]
+			lastPreferred = false
 		}
-		if result.error != nil {
-			return
-		}
-		result.resolved = true
+		return ip
+	}
 
-		if ipv6 {
-			result.Conn, result.error = dialer.DialContext(ctx, "tcp6", net.JoinHostPort(ip.String(), port))
-		} else {
-			result.Conn, result.error = dialer.DialContext(ctx, "tcp4", net.JoinHostPort(ip.String(), port))
-		}
+	start := func() {
+		attempts++
+		inflight++
+		go dial(next())
+		delay = time.After(connectionAttemptDelay)
 	}
 
-	go startRacer(ctx, host, false)
-	go startRacer(ctx, host, true)
+	pending := func() bool {
+		return len(preferred)+len(other) != 0
+	}
 
 	for {
 		select {
+		case res := <-resolved:
+			resolving--
+			if res.error != nil {
+				if resolveErr == nil || res.ipv6 == preferIPv6 {
+					resolveErr = res.error
+				}
+			} else if res.ipv6 == preferIPv6 {
+				preferred = append(preferred, res.ips...)
+			} else {
+				other = append(other, res.ips...)
+			}
+
+			if !pending() {
+				break
+			}
+
+			if attempts == 0 && len(preferred) == 0 && resolving != 0 {
+				// give the preferred family a chance before the first attempt
+				if delay == nil {
+					delay = time.After(resolutionDelay)
+				}
+			} else if inflight == 0 || delay == nil {
+				start()
+			}
+		case <-delay:
+			delay = nil
+			if pending() {
+				start()
+			}
 		case res := <-results:
+			inflight--
 			if res.error == nil {
 				return res.Conn, nil
 			}
 
-			if !res.ipv6 {
-				primary = res
-			} else {
-				fallback = res
+			dialErr = res.error
+			if pending() {
+				start()
 			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 
-			if primary.done && fallback.done {
-				if primary.resolved {
-					return nil, primary.error
-				} else if fallback.resolved {
-					return nil, fallback.error
-				} else {
-					return nil, primary.error
-				}
+		if resolving == 0 && inflight == 0 && !pending() {
+			if dialErr != nil {
+				return nil, dialErr
+			}
+			if resolveErr != nil {
+				return nil, resolveErr
 			}
+			return nil, fmt.Errorf("cannot resolve %s", host)
+		}
+	}
+}
+
+// resolveIP resolve host with the ip-version preference
+func resolveIP(host string) (net.IP, error) {
+	switch dialer.GetIPVersion() {
+	case dialer.IPv4Only:
+		return dns.ResolveIPv4(host)
+	case dialer.IPv6Only:
+		return dns.ResolveIPv6(host)
+	case dialer.PreferIPv4:
+		if ip, err := dns.ResolveIPv4(host); err == nil {
+			return ip, nil
 		}
+		return dns.ResolveIPv6(host)
+	default:
+		return dns.ResolveIP(host)
 	}
 }
 
@@ -172,7 +311,7 @@ func resolveUDPAddr(network, address string) (*net.UDPAddr, error) {
 		return nil, err
 	}
 
-	ip, err := dns.ResolveIP(host)
+	ip, err := resolveIP(host)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,149 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type addrConn struct {
+	net.Conn
+	addr string
+}
+
+func (c *addrConn) Close() error { return nil }
+
+func lookupAfter(delay time.Duration, ips ...string) func(string) ([]net.IP, error) {
+	return func(string) ([]net.IP, error) {
+		time.Sleep(delay)
+		result := []net.IP{}
+		for _, ip := range ips {
+			result = append(result, net.ParseIP(ip))
+		}
+		return result, nil
+	}
+}
+
+func lookupError(string) ([]net.IP, error) {
+	return nil, errors.New("no such host")
+}
+
+// dialRecorder record the attempted addresses, the addresses in fail are refused after refuseDelay
+// and those in blackhole hang until the attempt is canceled
+type dialRecorder struct {
+	mux         sync.Mutex
+	attempts    []string
+	fail        map[string]bool
+	blackhole   map[string]bool
+	refuseDelay time.Duration
+}
+
+func (d *dialRecorder) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	d.mux.Lock()
+	d.attempts = append(d.attempts, address)
+	d.mux.Unlock()
+
+	if d.blackhole[address] {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if d.fail[address] {
+		time.Sleep(d.refuseDelay)
+		return nil, errors.New("connection refused")
+	}
+	return &addrConn{addr: address}, nil
+}
+
+func (d *dialRecorder) recorded() []string {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return append([]string{}, d.attempts...)
+}
+
+func TestHappyEyeballs_Interleave(t *testing.T) {
+	// the attempts are refused after both families are resolved
+	d := &dialRecorder{refuseDelay: 20 * time.Millisecond, fail: map[string]bool{
+		"[::1]:80": true, "[::2]:80": true,
+		"127.0.0.1:80": true, "127.0.0.2:80": true, "127.0.0.3:80": true,
+	}}
+	h := &happyEyeballs{
+		lookupIPv4: lookupAfter(0, "127.0.0.1", "127.0.0.2", "127.0.0.3"),
+		lookupIPv6: lookupAfter(0, "::1", "::2"),
+		dial:       d.dial,
+	}
+
+	_, err := h.dialContext(context.Background(), "example.com", "80", true)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"[::1]:80", "127.0.0.1:80", "[::2]:80", "127.0.0.2:80", "127.0.0.3:80"}, d.recorded())
+
+	d = &dialRecorder{refuseDelay: d.refuseDelay, fail: d.fail}
+	h = &happyEyeballs{lookupIPv4: h.lookupIPv4, lookupIPv6: h.lookupIPv6, dial: d.dial}
+	_, err = h.dialContext(context.Background(), "example.com", "80", false)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"127.0.0.1:80", "[::1]:80", "127.0.0.2:80", "[::2]:80", "127.0.0.3:80"}, d.recorded())
+}
+
+func TestHappyEyeballs_ResolutionDelay(t *testing.T) {
+	// the preferred family resolved within resolutionDelay is attempted first
+	d := &dialRecorder{}
+	h := &happyEyeballs{
+		lookupIPv4: lookupAfter(0, "127.0.0.1"),
+		lookupIPv6: lookupAfter(resolutionDelay/5, "::1"),
+		dial:       d.dial,
+	}
+	c, err := h.dialContext(context.Background(), "example.com", "80", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "[::1]:80", c.(*addrConn).addr)
+
+	// the other family is attempted once resolutionDelay passes
+	d = &dialRecorder{}
+	h = &happyEyeballs{lookupIPv4: h.lookupIPv4, lookupIPv6: lookupAfter(resolutionDelay*4, "::1"), dial: d.dial}
+	start := time.Now()
+	c, err = h.dialContext(context.Background(), "example.com", "80", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:80", c.(*addrConn).addr)
+	assert.True(t, time.Since(start) < resolutionDelay*4)
+
+	// it is attempted without delay if the preferred family fails to resolve
+	d = &dialRecorder{}
+	h = &happyEyeballs{lookupIPv4: h.lookupIPv4, lookupIPv6: lookupError, dial: d.dial}
+	c, err = h.dialContext(context.Background(), "example.com", "80", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:80", c.(*addrConn).addr)
+}
+
+func TestHappyEyeballs_Fallback(t *testing.T) {
+	// the preferred address hangs, the other family is attempted after connectionAttemptDelay
+	d := &dialRecorder{blackhole: map[string]bool{"[::1]:80": true}}
+	h := &happyEyeballs{
+		lookupIPv4: lookupAfter(0, "127.0.0.1"),
+		lookupIPv6: lookupAfter(0, "::1"),
+		dial:       d.dial,
+	}
+
+	start := time.Now()
+	c, err := h.dialContext(context.Background(), "example.com", "80", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:80", c.(*addrConn).addr)
+	assert.True(t, time.Since(start) >= connectionAttemptDelay)
+	assert.Equal(t, []string{"[::1]:80", "127.0.0.1:80"}, d.recorded())
+
+	// a refused attempt starts the next one at once
+	d = &dialRecorder{fail: map[string]bool{"[::1]:80": true}}
+	h = &happyEyeballs{lookupIPv4: h.lookupIPv4, lookupIPv6: h.lookupIPv6, dial: d.dial}
+	start = time.Now()
+	c, err = h.dialContext(context.Background(), "example.com", "80", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:80", c.(*addrConn).addr)
+	assert.True(t, time.Since(start) < connectionAttemptDelay)
+
+	// both families fail to resolve
+	h = &happyEyeballs{lookupIPv4: lookupError, lookupIPv6: lookupError, dial: d.dial}
+	_, err = h.dialContext(context.Background(), "example.com", "80", true)
+	assert.Error(t, err)
+}
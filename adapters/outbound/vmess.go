@@ -2,38 +2,58 @@ package adapters
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"strconv"
 	"strings"
 
+	"github.com/ClashrAuto/Clashr/component/mux"
 	"github.com/ClashrAuto/Clashr/component/vmess"
 	C "github.com/ClashrAuto/Clashr/constant"
 )
 
 type Vmess struct {
 	*Base
-	server string
-	client *vmess.Client
+	server    string
+	client    *vmess.Client
+	muxClient *mux.Client
 }
 
 type VmessOption struct {
-	Name           string            `proxy:"name"`
-	Server         string            `proxy:"server"`
-	Port           int               `proxy:"port"`
-	UUID           string            `proxy:"uuid"`
-	AlterID        int               `proxy:"alterId"`
-	Cipher         string            `proxy:"cipher"`
-	TLS            bool              `proxy:"tls,omitempty"`
-	UDP            bool              `proxy:"udp,omitempty"`
-	Network        string            `proxy:"network,omitempty"`
-	WSPath         string            `proxy:"ws-path,omitempty"`
-	WSHeaders      map[string]string `proxy:"ws-headers,omitempty"`
-	SkipCertVerify bool              `proxy:"skip-cert-verify,omitempty"`
+	BasicOption
+	Name           string                 `proxy:"name"`
+	Server         string                 `proxy:"server"`
+	Port           int                    `proxy:"port"`
+	UUID           string                 `proxy:"uuid"`
+	AlterID        int                    `proxy:"alterId"`
+	Cipher         string                 `proxy:"cipher"`
+	TLS            bool                   `proxy:"tls,omitempty"`
+	UDP            bool                   `proxy:"udp,omitempty"`
+	Network        string                 `proxy:"network,omitempty"`
+	WSPath         string                 `proxy:"ws-path,omitempty"`
+	WSHeaders      map[string]string      `proxy:"ws-headers,omitempty"`
+	SkipCertVerify bool                   `proxy:"skip-cert-verify,omitempty"`
+	TLSOpts        map[string]interface{} `proxy:"tls-opts,omitempty"`
+	Mux            bool                   `proxy:"mux,omitempty"`
+	MuxConcurrency int                    `proxy:"mux-concurrency,omitempty"`
 }
 
 func (v *Vmess) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
-	c, err := dialContext(ctx, "tcp", v.server)
+	if v.muxClient != nil {
+		host := metadata.Host
+		if metadata.DstIP != nil {
+			host = metadata.DstIP.String()
+		}
+		port, _ := strconv.Atoi(metadata.DstPort)
+		c, err := v.muxClient.DialContext(ctx, "tcp", host, uint16(port))
+		if err != nil {
+			return nil, fmt.Errorf("%s connect error: %s", v.server, err.Error())
+		}
+		return newConn(c, v), nil
+	}
+
+	c, err := dialContext(ctx, "tcp", v.server, v.sockopt)
 	if err != nil {
 		return nil, fmt.Errorf("%s connect error", v.server)
 	}
@@ -45,7 +65,7 @@ func (v *Vmess) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn,
 func (v *Vmess) DialUDP(metadata *C.Metadata) (C.PacketConn, net.Addr, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), tcpTimeout)
 	defer cancel()
-	c, err := dialContext(ctx, "tcp", v.server)
+	c, err := dialContext(ctx, "tcp", v.server, v.sockopt)
 	if err != nil {
 		return nil, nil, fmt.Errorf("%s connect error", v.server)
 	}
@@ -59,6 +79,21 @@ func (v *Vmess) DialUDP(metadata *C.Metadata) (C.PacketConn, net.Addr, error) {
 
 func NewVmess(option VmessOption) (*Vmess, error) {
 	security := strings.ToLower(option.Cipher)
+
+	var tlsConfig *tls.Config
+	if option.TLS {
+		serverName := option.Server
+		if host, ok := option.WSHeaders["Host"]; ok {
+			serverName = host
+		}
+
+		var err error
+		tlsConfig, err = newTLSConfig(option.TLSOpts, serverName, option.SkipCertVerify)
+		if err != nil {
+			return nil, fmt.Errorf("vmess %s initialize tls error: %s", net.JoinHostPort(option.Server, strconv.Itoa(option.Port)), err.Error())
+		}
+	}
+
 	client, err := vmess.NewClient(vmess.Config{
 		UUID:             option.UUID,
 		AlterID:          uint16(option.AlterID),
@@ -71,20 +106,43 @@ func NewVmess(option VmessOption) (*Vmess, error) {
 		WebSocketHeaders: option.WSHeaders,
 		SkipCertVerify:   option.SkipCertVerify,
 		SessionCache:     getClientSessionCache(),
+		TLSConfig:        tlsConfig,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	return &Vmess{
+	v := &Vmess{
 		Base: &Base{
-			name: option.Name,
-			tp:   C.Vmess,
-			udp:  true,
+			name:    option.Name,
+			tp:      C.Vmess,
+			udp:     true,
+			sockopt: option.socketOption(),
 		},
 		server: net.JoinHostPort(option.Server, strconv.Itoa(option.Port)),
 		client: client,
-	}, nil
+	}
+
+	if option.Mux {
+		v.muxClient = mux.NewClient(v.dialMux, mux.Option{Concurrency: option.MuxConcurrency})
+	}
+	return v, nil
+}
+
+// dialMux establish a vmess connection carrying Mux.Cool sessions
+func (v *Vmess) dialMux(ctx context.Context) (net.Conn, error) {
+	c, err := dialContext(ctx, "tcp", v.server, v.sockopt)
+	if err != nil {
+		return nil, err
+	}
+	tcpKeepAlive(c)
+	return v.client.New(c, &vmess.DstAddr{Mux: true})
+}
+
+func (v *Vmess) Destroy() {
+	if v.muxClient != nil {
+		v.muxClient.Close()
+	}
 }
 
 func parseVmessAddr(metadata *C.Metadata) *vmess.DstAddr {
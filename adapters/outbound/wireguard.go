@@ -0,0 +1,390 @@
+package adapters
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ClashrAuto/Clashr/component/dialer"
+	C "github.com/ClashrAuto/Clashr/constant"
+	"github.com/ClashrAuto/Clashr/dns"
+	"github.com/ClashrAuto/Clashr/log"
+
+	wgconn "golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+)
+
+const defaultWireGuardMTU = 1420
+
+type WireGuard struct {
+	*Base
+	server     string
+	port       int
+	localAddrs []netip.Addr
+	mtu        int
+
+	// uapi is the device configuration without endpoint,
+	// endpoint is resolved when the device is brought up.
+	uapi string
+
+	mux    sync.Mutex
+	device *device.Device
+	tnet   *netstack.Net
+}
+
+type WireGuardOption struct {
+	BasicOption
+	Name                string   `proxy:"name"`
+	Server              string   `proxy:"server"`
+	Port                int      `proxy:"port"`
+	PrivateKey          string   `proxy:"private-key"`
+	PublicKey           string   `proxy:"public-key"`
+	PreSharedKey        string   `proxy:"pre-shared-key,omitempty"`
+	LocalAddress        []string `proxy:"local-address"`
+	AllowedIPs          []string `proxy:"allowed-ips,omitempty"`
+	MTU                 int      `proxy:"mtu,omitempty"`
+	PersistentKeepalive int      `proxy:"persistent-keepalive,omitempty"`
+	UDP                 bool     `proxy:"udp,omitempty"`
+}
+
+// stack bring up the userspace device on first use,
+// so that the endpoint is resolved after dns is ready.
+func (wg *WireGuard) stack() (*netstack.Net, error) {
+	wg.mux.Lock()
+	defer wg.mux.Unlock()
+
+	if wg.tnet != nil {
+		return wg.tnet, nil
+	}
+
+	ip, err := dns.ResolveIP(wg.server)
+	if err != nil {
+		return nil, fmt.Errorf("wireguard %s resolve endpoint error: %s", wg.server, err.Error())
+	}
+
+	tunDev, tnet, err := netstack.CreateNetTUN(wg.localAddrs, nil, wg.mtu)
+	if err != nil {
+		return nil, fmt.Errorf("wireguard %s create netstack error: %s", wg.name, err.Error())
+	}
+
+	prefix := fmt.Sprintf("[WireGuard] %s: ", wg.name)
+	logger := &device.Logger{
+		Verbosef: func(format string, args ...interface{}) {
+			log.Debugln(prefix+format, args...)
+		},
+		Errorf: func(format string, args ...interface{}) {
+			log.Warnln(prefix+format, args...)
+		},
+	}
+
+	dev := device.NewDevice(tunDev, &wireGuardBind{sockopt: wg.sockopt}, logger)
+	uapi := wg.uapi + fmt.Sprintf("endpoint=%s\n", net.JoinHostPort(ip.String(), strconv.Itoa(wg.port)))
+	if err := dev.IpcSet(uapi); err != nil {
+		dev.Close()
+		return nil, fmt.Errorf("wireguard %s configure error: %s", wg.name, err.Error())
+	}
+
+	if err := dev.Up(); err != nil {
+		dev.Close()
+		return nil, fmt.Errorf("wireguard %s up error: %s", wg.name, err.Error())
+	}
+
+	wg.device = dev
+	wg.tnet = tnet
+	return tnet, nil
+}
+
+// wireGuardBind is the udp socket of the tunnel, it is opened by dialer
+// so that the socket options of the proxy apply to it
+type wireGuardBind struct {
+	sockopt *dialer.Option
+
+	mux sync.Mutex
+	pc  net.PacketConn
+}
+
+type wireGuardEndpoint netip.AddrPort
+
+func (e wireGuardEndpoint) ClearSrc()           {}
+func (e wireGuardEndpoint) SrcToString() string { return "" }
+func (e wireGuardEndpoint) DstToString() string { return netip.AddrPort(e).String() }
+func (e wireGuardEndpoint) DstIP() netip.Addr   { return netip.AddrPort(e).Addr() }
+func (e wireGuardEndpoint) SrcIP() netip.Addr   { return netip.Addr{} }
+
+func (e wireGuardEndpoint) DstToBytes() []byte {
+	buf, _ := netip.AddrPort(e).MarshalBinary()
+	return buf
+}
+
+func newWireGuardEndpoint(addr netip.AddrPort) wireGuardEndpoint {
+	return wireGuardEndpoint(netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port()))
+}
+
+func (b *wireGuardBind) Open(port uint16) ([]wgconn.ReceiveFunc, uint16, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if b.pc != nil {
+		return nil, 0, wgconn.ErrBindAlreadyOpen
+	}
+
+	// an empty address let dialer bind the source ip
+	address := ""
+	if port != 0 {
+		address = net.JoinHostPort("", strconv.Itoa(int(port)))
+	}
+	pc, err := dialer.ListenPacket("udp", address, b.sockopt)
+	if err != nil {
+		return nil, 0, err
+	}
+	b.pc = pc
+
+	receive := func(packets [][]byte, sizes []int, eps []wgconn.Endpoint) (int, error) {
+		n, addr, err := pc.ReadFrom(packets[0])
+		if err != nil {
+			return 0, err
+		}
+		sizes[0] = n
+		eps[0] = newWireGuardEndpoint(addr.(*net.UDPAddr).AddrPort())
+		return 1, nil
+	}
+	return []wgconn.ReceiveFunc{receive}, uint16(pc.LocalAddr().(*net.UDPAddr).Port), nil
+}
+
+func (b *wireGuardBind) Close() error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if b.pc == nil {
+		return nil
+	}
+	err := b.pc.Close()
+	b.pc = nil
+	return err
+}
+
+// SetMark is a no-op, the routing mark of sockopt is set when the socket is opened
+func (b *wireGuardBind) SetMark(mark uint32) error {
+	return nil
+}
+
+func (b *wireGuardBind) Send(bufs [][]byte, ep wgconn.Endpoint) error {
+	b.mux.Lock()
+	pc := b.pc
+	b.mux.Unlock()
+
+	if pc == nil {
+		return net.ErrClosed
+	}
+
+	endpoint, ok := ep.(wireGuardEndpoint)
+	if !ok {
+		return wgconn.ErrWrongEndpointType
+	}
+
+	addr := net.UDPAddrFromAddrPort(netip.AddrPort(endpoint))
+	for _, buf := range bufs {
+		if _, err := pc.WriteTo(buf, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *wireGuardBind) ParseEndpoint(s string) (wgconn.Endpoint, error) {
+	addr, err := netip.ParseAddrPort(s)
+	if err != nil {
+		return nil, err
+	}
+	return newWireGuardEndpoint(addr), nil
+}
+
+func (b *wireGuardBind) BatchSize() int {
+	return 1
+}
+
+// localAddr return a local address in the same family of ip
+func (wg *WireGuard) localAddr(ip net.IP) (net.IP, error) {
+	ipv4 := ip.To4() != nil
+	for _, addr := range wg.localAddrs {
+		if addr.Is4() == ipv4 {
+			return net.IP(addr.AsSlice()), nil
+		}
+	}
+	return nil, fmt.Errorf("wireguard %s has no local address for %s", wg.name, ip.String())
+}
+
+func resolveMetadataIP(metadata *C.Metadata) (net.IP, error) {
+	if metadata.DstIP != nil {
+		return *metadata.DstIP, nil
+	}
+	return resolveIP(metadata.Host)
+}
+
+func (wg *WireGuard) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
+	tnet, err := wg.stack()
+	if err != nil {
+		return nil, err
+	}
+
+	ip, err := resolveMetadataIP(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := tnet.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), metadata.DstPort))
+	if err != nil {
+		return nil, fmt.Errorf("%s connect error: %s", metadata.RemoteAddress(), err.Error())
+	}
+	return newConn(c, wg), nil
+}
+
+func (wg *WireGuard) DialUDP(metadata *C.Metadata) (C.PacketConn, net.Addr, error) {
+	tnet, err := wg.stack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ip, err := resolveMetadataIP(metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	port, err := strconv.Atoi(metadata.DstPort)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	local, err := wg.localAddr(ip)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pc, err := tnet.ListenUDP(&net.UDPAddr{IP: local})
+	if err != nil {
+		return nil, nil, err
+	}
+	return newPacketConn(pc, wg), &net.UDPAddr{IP: ip, Port: port}, nil
+}
+
+func (wg *WireGuard) Destroy() {
+	wg.mux.Lock()
+	defer wg.mux.Unlock()
+
+	if wg.device != nil {
+		wg.device.Close()
+		wg.device = nil
+		wg.tnet = nil
+	}
+}
+
+func (wg *WireGuard) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type": wg.Type().String(),
+		"udp":  wg.SupportUDP(),
+	})
+}
+
+// decodeWireGuardKey convert a base64 encoded key to the hex form of uapi
+func decodeWireGuardKey(key string) (string, error) {
+	buf, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return "", err
+	}
+	if len(buf) != 32 {
+		return "", errors.New("key must be 32 bytes")
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func parseLocalAddress(s string) (netip.Addr, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Addr{}, err
+		}
+		return prefix.Addr(), nil
+	}
+	return netip.ParseAddr(s)
+}
+
+func NewWireGuard(option WireGuardOption) (*WireGuard, error) {
+	server := net.JoinHostPort(option.Server, strconv.Itoa(option.Port))
+
+	privateKey, err := decodeWireGuardKey(option.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("wireguard %s private-key error: %s", server, err.Error())
+	}
+
+	publicKey, err := decodeWireGuardKey(option.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("wireguard %s public-key error: %s", server, err.Error())
+	}
+
+	if len(option.LocalAddress) == 0 {
+		return nil, fmt.Errorf("wireguard %s missing local-address", server)
+	}
+
+	localAddrs := make([]netip.Addr, 0, len(option.LocalAddress))
+	for _, s := range option.LocalAddress {
+		addr, err := parseLocalAddress(s)
+		if err != nil {
+			return nil, fmt.Errorf("wireguard %s local-address error: %s", server, err.Error())
+		}
+		localAddrs = append(localAddrs, addr)
+	}
+
+	allowedIPs := option.AllowedIPs
+	if len(allowedIPs) == 0 {
+		allowedIPs = []string{"0.0.0.0/0", "::/0"}
+	}
+
+	uapi := &strings.Builder{}
+	fmt.Fprintf(uapi, "private_key=%s\n", privateKey)
+	fmt.Fprintf(uapi, "public_key=%s\n", publicKey)
+	if option.PreSharedKey != "" {
+		preSharedKey, err := decodeWireGuardKey(option.PreSharedKey)
+		if err != nil {
+			return nil, fmt.Errorf("wireguard %s pre-shared-key error: %s", server, err.Error())
+		}
+		fmt.Fprintf(uapi, "preshared_key=%s\n", preSharedKey)
+	}
+	if option.PersistentKeepalive != 0 {
+		fmt.Fprintf(uapi, "persistent_keepalive_interval=%d\n", option.PersistentKeepalive)
+	}
+	for _, cidr := range allowedIPs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("wireguard %s allowed-ips error: %s", server, err.Error())
+		}
+		fmt.Fprintf(uapi, "allowed_ip=%s\n", prefix.String())
+	}
+
+	mtu := option.MTU
+	if mtu == 0 {
+		mtu = defaultWireGuardMTU
+	}
+
+	return &WireGuard{
+		Base: &Base{
+			name:    option.Name,
+			tp:      C.WireGuard,
+			udp:     option.UDP,
+			sockopt: option.socketOption(),
+		},
+		server:     option.Server,
+		port:       option.Port,
+		localAddrs: localAddrs,
+		mtu:        mtu,
+		uapi:       uapi.String(),
+	}, nil
+}
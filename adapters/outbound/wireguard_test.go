@@ -0,0 +1,167 @@
+package adapters
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/ClashrAuto/Clashr/component/dialer"
+	C "github.com/ClashrAuto/Clashr/constant"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/curve25519"
+	wgconn "golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+)
+
+func newWireGuardKey(t *testing.T) (private, public []byte) {
+	private = make([]byte, 32)
+	rand.Read(private)
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	assert.Nil(t, err)
+	return
+}
+
+// newWireGuardPeer start a peer listening on loopback with an echo server on 10.0.0.1:80 inside the tunnel
+func newWireGuardPeer(t *testing.T, private, clientPublic []byte) (port int, closer func()) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	port = l.LocalAddr().(*net.UDPAddr).Port
+	l.Close()
+
+	tunDev, tnet, err := netstack.CreateNetTUN([]netip.Addr{netip.MustParseAddr("10.0.0.1")}, nil, defaultWireGuardMTU)
+	assert.Nil(t, err)
+
+	dev := device.NewDevice(tunDev, wgconn.NewDefaultBind(), device.NewLogger(device.LogLevelSilent, ""))
+	uapi := fmt.Sprintf("private_key=%s\nlisten_port=%d\npublic_key=%s\nallowed_ip=10.0.0.2/32\n",
+		hex.EncodeToString(private), port, hex.EncodeToString(clientPublic))
+	assert.Nil(t, dev.IpcSet(uapi))
+	assert.Nil(t, dev.Up())
+
+	ln, err := tnet.ListenTCP(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 80})
+	assert.Nil(t, err)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(c, c)
+				c.Close()
+			}()
+		}
+	}()
+
+	return port, func() {
+		ln.Close()
+		dev.Close()
+	}
+}
+
+func TestWireGuard_Loopback(t *testing.T) {
+	serverPrivate, serverPublic := newWireGuardKey(t)
+	clientPrivate, clientPublic := newWireGuardKey(t)
+
+	port, closer := newWireGuardPeer(t, serverPrivate, clientPublic)
+	defer closer()
+
+	wg, err := NewWireGuard(WireGuardOption{
+		Name:         "wg",
+		Server:       "127.0.0.1",
+		Port:         port,
+		PrivateKey:   base64.StdEncoding.EncodeToString(clientPrivate),
+		PublicKey:    base64.StdEncoding.EncodeToString(serverPublic),
+		LocalAddress: []string{"10.0.0.2/32"},
+		AllowedIPs:   []string{"10.0.0.0/24"},
+	})
+	assert.Nil(t, err)
+	defer wg.Destroy()
+
+	ip := net.ParseIP("10.0.0.1")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := wg.DialContext(ctx, &C.Metadata{AddrType: C.AtypIPv4, DstIP: &ip, DstPort: "80"})
+	assert.Nil(t, err)
+	if err != nil {
+		return
+	}
+	defer c.Close()
+
+	_, err = c.Write([]byte("ping"))
+	assert.Nil(t, err)
+
+	buf := make([]byte, 4)
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadFull(c, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("ping"), buf)
+}
+
+func TestWireGuard_BindSocketOption(t *testing.T) {
+	peer, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer peer.Close()
+
+	bind := &wireGuardBind{sockopt: &dialer.Option{SourceIP: net.ParseIP("127.0.0.1")}}
+	fns, port, err := bind.Open(0)
+	assert.Nil(t, err)
+	defer bind.Close()
+	assert.Len(t, fns, 1)
+
+	_, _, err = bind.Open(0)
+	assert.Equal(t, wgconn.ErrBindAlreadyOpen, err)
+
+	ep, err := bind.ParseEndpoint(peer.LocalAddr().String())
+	assert.Nil(t, err)
+	assert.Nil(t, bind.Send([][]byte{[]byte("ping")}, ep))
+
+	// the tunnel socket is bound to the source ip of sockopt
+	buf := make([]byte, 16)
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, addr, err := peer.ReadFrom(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "ping", string(buf[:n]))
+	assert.Equal(t, "127.0.0.1", addr.(*net.UDPAddr).IP.String())
+	assert.Equal(t, int(port), addr.(*net.UDPAddr).Port)
+
+	_, err = peer.WriteTo([]byte("pong"), addr)
+	assert.Nil(t, err)
+
+	packets := [][]byte{make([]byte, 16)}
+	sizes := make([]int, 1)
+	eps := make([]wgconn.Endpoint, 1)
+	n, err = fns[0](packets, sizes, eps)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, "pong", string(packets[0][:sizes[0]]))
+	assert.Equal(t, peer.LocalAddr().String(), eps[0].DstToString())
+
+	// the receive function returns net.ErrClosed after Close
+	assert.Nil(t, bind.Close())
+	_, err = fns[0](packets, sizes, eps)
+	assert.True(t, errors.Is(err, net.ErrClosed))
+}
+
+func TestNewWireGuard_Error(t *testing.T) {
+	_, public := newWireGuardKey(t)
+	key := base64.StdEncoding.EncodeToString(public)
+
+	_, err := NewWireGuard(WireGuardOption{Server: "127.0.0.1", Port: 51820, PrivateKey: "short", PublicKey: key, LocalAddress: []string{"10.0.0.2"}})
+	assert.Error(t, err)
+
+	_, err = NewWireGuard(WireGuardOption{Server: "127.0.0.1", Port: 51820, PrivateKey: key, PublicKey: key})
+	assert.Error(t, err)
+
+	_, err = NewWireGuard(WireGuardOption{Server: "127.0.0.1", Port: 51820, PrivateKey: key, PublicKey: key, LocalAddress: []string{"10.0.0.2"}, AllowedIPs: []string{"bad"}})
+	assert.Error(t, err)
+}
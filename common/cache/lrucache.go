@@ -124,6 +124,28 @@ func (c *LruCache) Set(key interface{}, value interface{}) {
 	c.maybeDeleteOldest()
 }
 
+// Len returns the count of elements, including the expired ones not evicted yet
+func (c *LruCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+// Range calls f on each key and value from the least recently used to the most,
+// it stops if f returns false. The order of the elements is not changed.
+func (c *LruCache) Range(f func(key, value interface{}) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for le := c.lru.Front(); le != nil; le = le.Next() {
+		e := le.Value.(*entry)
+		if !f(e.key, e.value) {
+			return
+		}
+	}
+}
+
 // Delete removes the value associated with a key.
 func (c *LruCache) Delete(key string) {
 	c.mu.Lock()
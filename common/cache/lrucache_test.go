@@ -115,3 +115,19 @@ func TestMaxSize(t *testing.T) {
 	_, ok = c.Get("foo")
 	assert.False(t, ok)
 }
+
+func TestRange(t *testing.T) {
+	c := NewLRUCache()
+	for _, e := range entries {
+		c.Set(e.key, e.value)
+	}
+	c.Get("1")
+
+	keys := []interface{}{}
+	c.Range(func(key, value interface{}) bool {
+		keys = append(keys, key)
+		return len(keys) < 3
+	})
+	assert.Equal(t, []interface{}{"2", "3", "4"}, keys)
+	assert.Equal(t, len(entries), c.Len())
+}
@@ -38,6 +38,14 @@ func (d *Decoder) Decode(src map[string]interface{}, dst interface{}) error {
 	for idx := 0; idx < v.NumField(); idx++ {
 		field := t.Field(idx)
 
+		// embedded struct shares the keys of its parent
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := d.Decode(src, v.Field(idx).Addr().Interface()); err != nil {
+				return err
+			}
+			continue
+		}
+
 		tag := field.Tag.Get(d.option.TagName)
 		str := strings.SplitN(tag, ",", 2)
 		key := str[0]
@@ -112,6 +120,8 @@ func (d *Decoder) decodeString(name string, data interface{}, val reflect.Value)
 		val.SetString(dataVal.String())
 	case kind == reflect.Int && d.option.WeaklyTypedInput:
 		val.SetString(strconv.FormatInt(dataVal.Int(), 10))
+	case kind == reflect.Float64 && d.option.WeaklyTypedInput:
+		val.SetString(strconv.FormatFloat(dataVal.Float(), 'f', -1, 64))
 	default:
 		err = fmt.Errorf(
 			"'%s' expected type '%s', got unconvertible type '%s'",
@@ -139,3 +139,29 @@ func TestStructure_WeakType(t *testing.T) {
 		t.Fatalf("bad: %#v", s)
 	}
 }
+
+type BazEmbedded struct {
+	BazOptional
+	Extra bool `test:"extra"`
+}
+
+func TestStructure_Embedded(t *testing.T) {
+	rawMap := map[string]interface{}{
+		"foo":   1,
+		"extra": true,
+	}
+
+	goal := &BazEmbedded{
+		BazOptional: BazOptional{Foo: 1},
+		Extra:       true,
+	}
+
+	s := &BazEmbedded{}
+	err := decoder.Decode(rawMap, s)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(s, goal) {
+		t.Fatalf("bad: %#v", s)
+	}
+}
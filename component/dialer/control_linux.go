@@ -0,0 +1,28 @@
+package dialer
+
+import (
+	"syscall"
+)
+
+func control(opt *Option) func(network, address string, c syscall.RawConn) error {
+	if opt.Interface == "" && opt.RoutingMark == 0 {
+		return nil
+	}
+
+	return func(network, address string, c syscall.RawConn) (err error) {
+		ctrlErr := c.Control(func(fd uintptr) {
+			if opt.Interface != "" {
+				if err = syscall.BindToDevice(int(fd), opt.Interface); err != nil {
+					return
+				}
+			}
+			if opt.RoutingMark != 0 {
+				err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_MARK, opt.RoutingMark)
+			}
+		})
+		if ctrlErr != nil {
+			return ctrlErr
+		}
+		return
+	}
+}
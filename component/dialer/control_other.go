@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package dialer
+
+import (
+	"errors"
+	"syscall"
+)
+
+var errNotSupported = errors.New("interface binding and routing mark are only supported on linux")
+
+func control(opt *Option) func(network, address string, c syscall.RawConn) error {
+	if opt.Interface == "" && opt.RoutingMark == 0 {
+		return nil
+	}
+
+	return func(network, address string, c syscall.RawConn) error {
+		return errNotSupported
+	}
+}
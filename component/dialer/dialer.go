@@ -0,0 +1,127 @@
+package dialer
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// Option is the socket options applied to outbound sockets
+type Option struct {
+	// Interface bind the socket to a network interface (SO_BINDTODEVICE)
+	Interface string
+	// RoutingMark set the fwmark of the socket (SO_MARK)
+	RoutingMark int
+	// SourceIP is the local address of the socket
+	SourceIP net.IP
+}
+
+func (o *Option) isEmpty() bool {
+	return o.Interface == "" && o.RoutingMark == 0 && o.SourceIP == nil
+}
+
+var (
+	defaultOption = &Option{}
+	mux           sync.RWMutex
+)
+
+// SetDefault set the global socket options, it is used when a proxy has no option of its own
+func SetDefault(opt *Option) {
+	if opt == nil {
+		opt = &Option{}
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	defaultOption = opt
+}
+
+// Default return the global socket options
+func Default() *Option {
+	mux.RLock()
+	defer mux.RUnlock()
+	return defaultOption
+}
+
+// merge fill the empty fields of opt with the global options
+func merge(opt *Option) *Option {
+	def := Default()
+	if opt == nil {
+		return def
+	}
+
+	merged := *opt
+	if merged.Interface == "" {
+		merged.Interface = def.Interface
+	}
+	if merged.RoutingMark == 0 {
+		merged.RoutingMark = def.RoutingMark
+	}
+	if merged.SourceIP == nil {
+		merged.SourceIP = def.SourceIP
+	}
+	return &merged
+}
+
+// sourceIP return SourceIP if it matches the family of network
+func (o *Option) sourceIP(network string) net.IP {
+	if o.SourceIP == nil {
+		return nil
+	}
+
+	isIPv4 := o.SourceIP.To4() != nil
+	switch network[len(network)-1] {
+	case '4':
+		if !isIPv4 {
+			return nil
+		}
+	case '6':
+		if isIPv4 {
+			return nil
+		}
+	}
+	return o.SourceIP
+}
+
+// Dialer return a net.Dialer for network with opt and the global options
+func Dialer(network string, opt *Option) *net.Dialer {
+	opt = merge(opt)
+	dialer := &net.Dialer{}
+	if opt.isEmpty() {
+		return dialer
+	}
+
+	if ip := opt.sourceIP(network); ip != nil {
+		switch network {
+		case "udp", "udp4", "udp6":
+			dialer.LocalAddr = &net.UDPAddr{IP: ip}
+		default:
+			dialer.LocalAddr = &net.TCPAddr{IP: ip}
+		}
+	}
+	dialer.Control = control(opt)
+	return dialer
+}
+
+// DialContext is like net.Dialer.DialContext with opt and the global options
+func DialContext(ctx context.Context, network, address string, opt *Option) (net.Conn, error) {
+	return Dialer(network, opt).DialContext(ctx, network, address)
+}
+
+// ListenPacket is like net.ListenPacket with opt and the global options,
+// the source ip is used when address is empty.
+func ListenPacket(network, address string, opt *Option) (net.PacketConn, error) {
+	opt = merge(opt)
+	if opt.isEmpty() {
+		return net.ListenPacket(network, address)
+	}
+
+	if address == "" {
+		if ip := opt.sourceIP(network); ip != nil {
+			address = net.JoinHostPort(ip.String(), "0")
+		}
+	}
+
+	lc := &net.ListenConfig{Control: control(opt)}
+	return lc.ListenPacket(context.Background(), network, address)
+}
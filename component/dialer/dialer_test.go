@@ -0,0 +1,49 @@
+package dialer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialer_Merge(t *testing.T) {
+	SetDefault(&Option{Interface: "eth0", RoutingMark: 255})
+	defer SetDefault(nil)
+
+	opt := merge(&Option{RoutingMark: 1})
+	assert.Equal(t, "eth0", opt.Interface)
+	assert.Equal(t, 1, opt.RoutingMark)
+
+	assert.Equal(t, Default(), merge(nil))
+}
+
+func TestDialer_SourceIP(t *testing.T) {
+	opt := &Option{SourceIP: net.ParseIP("127.0.0.1")}
+
+	d := Dialer("tcp4", opt)
+	assert.Equal(t, &net.TCPAddr{IP: opt.SourceIP}, d.LocalAddr)
+
+	// family mismatch, leave it to the system
+	d = Dialer("tcp6", opt)
+	assert.Nil(t, d.LocalAddr)
+}
+
+func TestDialer_ListenPacketSourceIP(t *testing.T) {
+	pc, err := ListenPacket("udp", "", &Option{SourceIP: net.ParseIP("127.0.0.1")})
+	assert.Nil(t, err)
+	defer pc.Close()
+
+	assert.True(t, pc.LocalAddr().(*net.UDPAddr).IP.Equal(net.ParseIP("127.0.0.1")))
+}
+
+func TestDialer_IPVersion(t *testing.T) {
+	var v IPVersion
+	assert.Nil(t, v.UnmarshalJSON([]byte(`"ipv4-only"`)))
+	assert.Equal(t, IPv4Only, v)
+	assert.Error(t, v.UnmarshalJSON([]byte(`"ipv5"`)))
+
+	buf, err := PreferIPv4.MarshalJSON()
+	assert.Nil(t, err)
+	assert.Equal(t, `"prefer-ipv4"`, string(buf))
+}
@@ -0,0 +1,92 @@
+package dialer
+
+import (
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	// IPVersionMapping is a mapping for IPVersion enum
+	IPVersionMapping = map[string]IPVersion{
+		PreferIPv6.String(): PreferIPv6,
+		PreferIPv4.String(): PreferIPv4,
+		IPv4Only.String():   IPv4Only,
+		IPv6Only.String():   IPv6Only,
+	}
+
+	ipVersion int32
+)
+
+// IPVersion is the address family preference of outbound dials
+const (
+	PreferIPv6 IPVersion = iota
+	PreferIPv4
+	IPv4Only
+	IPv6Only
+)
+
+type IPVersion int
+
+// SetIPVersion set the global address family preference
+func SetIPVersion(v IPVersion) {
+	atomic.StoreInt32(&ipVersion, int32(v))
+}
+
+// GetIPVersion return the global address family preference
+func GetIPVersion() IPVersion {
+	return IPVersion(atomic.LoadInt32(&ipVersion))
+}
+
+// UnmarshalYAML unserialize IPVersion with yaml
+func (v *IPVersion) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var tp string
+	if err := unmarshal(&tp); err != nil {
+		return err
+	}
+	version, exist := IPVersionMapping[tp]
+	if !exist {
+		return errors.New("invalid ip-version")
+	}
+	*v = version
+	return nil
+}
+
+// MarshalYAML serialize IPVersion with yaml
+func (v IPVersion) MarshalYAML() ([]byte, error) {
+	return yaml.Marshal(v.String())
+}
+
+// UnmarshalJSON unserialize IPVersion with json
+func (v *IPVersion) UnmarshalJSON(data []byte) error {
+	var tp string
+	json.Unmarshal(data, &tp)
+	version, exist := IPVersionMapping[tp]
+	if !exist {
+		return errors.New("invalid ip-version")
+	}
+	*v = version
+	return nil
+}
+
+// MarshalJSON serialize IPVersion with json
+func (v IPVersion) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.String())
+}
+
+func (v IPVersion) String() string {
+	switch v {
+	case PreferIPv6:
+		return "prefer-ipv6"
+	case PreferIPv4:
+		return "prefer-ipv4"
+	case IPv4Only:
+		return "ipv4-only"
+	case IPv6Only:
+		return "ipv6-only"
+	default:
+		return "unknown"
+	}
+}
@@ -6,8 +6,9 @@ import (
 )
 
 const (
-	wildcard   = "*"
-	domainStep = "."
+	wildcard        = "*"
+	complexWildcard = "+"
+	domainStep      = "."
 )
 
 var (
@@ -16,7 +17,7 @@ var (
 )
 
 // Trie contains the main logic for adding and searching nodes for domain segments.
-// support wildcard domain (e.g *.google.com)
+// support wildcard domain (e.g *.google.com) and suffix domain (e.g +.google.com)
 type Trie struct {
 	root *Node
 }
@@ -30,11 +31,28 @@ func isValidDomain(domain string) bool {
 // 1. www.example.com
 // 2. *.example.com
 // 3. subdomain.*.example.com
+// 4. +.example.com, which matches example.com and all of its subdomains
 func (t *Trie) Insert(domain string, data interface{}) error {
 	if !isValidDomain(domain) {
 		return ErrInvalidDomain
 	}
 
+	if strings.HasPrefix(domain, complexWildcard+domainStep) {
+		suffix := domain[len(complexWildcard+domainStep):]
+		if !isValidDomain(suffix) {
+			return ErrInvalidDomain
+		}
+
+		t.insert(suffix, data)
+		t.insert(domain, data)
+		return nil
+	}
+
+	t.insert(domain, data)
+	return nil
+}
+
+func (t *Trie) insert(domain string, data interface{}) {
 	parts := strings.Split(domain, domainStep)
 	node := t.root
 	// reverse storage domain part to save space
@@ -48,27 +66,32 @@ func (t *Trie) Insert(domain string, data interface{}) error {
 	}
 
 	node.Data = data
-	return nil
 }
 
 // Search is the most important part of the Trie.
 // Priority as:
 // 1. static part
 // 2. wildcard domain
+// 3. the longest suffix domain
 func (t *Trie) Search(domain string) *Node {
 	if !isValidDomain(domain) {
 		return nil
 	}
 	parts := strings.Split(domain, domainStep)
 
+	var suffix *Node
 	n := t.root
 	for i := len(parts) - 1; i >= 0; i-- {
 		part := parts[i]
 
+		if child := n.getChild(complexWildcard); child != nil && child.Data != nil {
+			suffix = child
+		}
+
 		var child *Node
 		if !n.hasChild(part) {
 			if !n.hasChild(wildcard) {
-				return nil
+				return suffix
 			}
 
 			child = n.getChild(wildcard)
@@ -80,7 +103,7 @@ func (t *Trie) Search(domain string) *Node {
 	}
 
 	if n.Data == nil {
-		return nil
+		return suffix
 	}
 
 	return n
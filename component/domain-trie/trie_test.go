@@ -65,6 +65,32 @@ func TestTrie_Wildcard(t *testing.T) {
 	}
 }
 
+func TestTrie_Suffix(t *testing.T) {
+	tree := New()
+	tree.Insert("+.example.com", localIP)
+	tree.Insert("www.example.com", net.IP{127, 0, 0, 2})
+
+	if tree.Search("example.com") == nil {
+		t.Error("should not recv nil")
+	}
+
+	if tree.Search("foo.bar.example.com") == nil {
+		t.Error("should not recv nil")
+	}
+
+	if !tree.Search("www.example.com").Data.(net.IP).Equal(net.IP{127, 0, 0, 2}) {
+		t.Error("should equal 127.0.0.2")
+	}
+
+	if tree.Search("notexample.com") != nil {
+		t.Error("should recv nil")
+	}
+
+	if tree.Insert("+.", localIP) == nil {
+		t.Error("should return error")
+	}
+}
+
 func TestTrie_Boundary(t *testing.T) {
 	tree := New()
 	tree.Insert("*.dev", localIP)
@@ -1,39 +1,61 @@
 package fakeip
 
 import (
+	"bytes"
 	"errors"
+	"math"
+	"math/big"
 	"net"
 	"sync"
 
 	"github.com/ClashrAuto/Clashr/common/cache"
 )
 
-// Pool is a implementation about fake ip generator without storage
+// Pool is a implementation about fake ip generator without storage,
+// the range is either IPv4 or IPv6, a range larger than 2^32 addresses only use the first 2^32.
 type Pool struct {
-	max     uint32
-	min     uint32
-	gateway uint32
-	offset  uint32
-	mux     *sync.Mutex
-	cache   *cache.LruCache
+	min *big.Int
+	// gateway and max are the bounds of the range
+	gateway net.IP
+	max     net.IP
+	// span is the count of offsets, an offset n in 1..span maps to min + n - 1
+	span     uint32
+	offset   uint32
+	ipLen    int
+	ipnet    *net.IPNet
+	size     int
+	mux      *sync.Mutex
+	cache    *cache.LruCache
+	onChange func()
+}
+
+// Binding is a host and the fake ip allocated to it
+type Binding struct {
+	Host string `json:"host"`
+	IP   net.IP `json:"ip"`
 }
 
 // Lookup return a fake ip with host
 func (p *Pool) Lookup(host string) net.IP {
 	p.mux.Lock()
-	defer p.mux.Unlock()
 	if elm, exist := p.cache.Get(host); exist {
 		ip := elm.(net.IP)
 
 		// ensure ip --> host on head of linked list
-		n := ipToUint(ip.To4())
-		offset := n - p.min + 1
-		p.cache.Get(offset)
+		p.cache.Get(p.ipToOffset(ip))
+		p.mux.Unlock()
 		return ip
 	}
 
 	ip := p.get(host)
 	p.cache.Set(host, ip)
+	onChange := p.onChange
+	p.mux.Unlock()
+
+	// called without the lock, so that onChange can read the bindings
+	if onChange != nil {
+		onChange()
+	}
 	return ip
 }
 
@@ -42,14 +64,11 @@ func (p *Pool) LookBack(ip net.IP) (string, bool) {
 	p.mux.Lock()
 	defer p.mux.Unlock()
 
-	if ip = ip.To4(); ip == nil {
+	if ip = p.normalize(ip); ip == nil || !p.contains(ip) {
 		return "", false
 	}
 
-	n := ipToUint(ip.To4())
-	offset := n - p.min + 1
-
-	if elm, exist := p.cache.Get(offset); exist {
+	if elm, exist := p.cache.Get(p.ipToOffset(ip)); exist {
 		host := elm.(string)
 
 		// ensure host --> ip on head of linked list
@@ -60,58 +79,171 @@ func (p *Pool) LookBack(ip net.IP) (string, bool) {
 	return "", false
 }
 
+// Contains return whether ip is in the range of the pool
+func (p *Pool) Contains(ip net.IP) bool {
+	if ip = p.normalize(ip); ip == nil {
+		return false
+	}
+	return p.contains(ip)
+}
+
+func (p *Pool) contains(ip net.IP) bool {
+	return bytes.Compare(ip, p.gateway) >= 0 && bytes.Compare(ip, p.max) <= 0
+}
+
+// IPNet return the range of the pool
+func (p *Pool) IPNet() *net.IPNet {
+	return p.ipnet
+}
+
+// IPv6 return whether the range of the pool is IPv6
+func (p *Pool) IPv6() bool {
+	return p.ipLen == net.IPv6len
+}
+
+// Bindings return the allocated fake ips from the least recently used
+func (p *Pool) Bindings() []Binding {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	bindings := []Binding{}
+	p.cache.Range(func(key, value interface{}) bool {
+		if host, ok := key.(string); ok {
+			bindings = append(bindings, Binding{Host: host, IP: value.(net.IP)})
+		}
+		return true
+	})
+	return bindings
+}
+
+// Restore allocate the fake ips of bindings again, the ones out of the range or taken are skipped
+func (p *Pool) Restore(bindings []Binding) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	for _, binding := range bindings {
+		ip := p.normalize(binding.IP)
+		if ip == nil || !p.contains(ip) {
+			continue
+		}
+
+		offset := p.ipToOffset(ip)
+		if p.cache.Exist(binding.Host) || p.cache.Exist(offset) {
+			continue
+		}
+
+		p.cache.Set(offset, binding.Host)
+		p.cache.Set(binding.Host, ip)
+		p.offset = offset
+	}
+}
+
+// Clear drop all the allocated fake ips
+func (p *Pool) Clear() {
+	p.mux.Lock()
+	p.offset = 0
+	p.cache = cache.NewLRUCache(cache.WithSize(p.size * 2))
+	onChange := p.onChange
+	p.mux.Unlock()
+
+	if onChange != nil {
+		onChange()
+	}
+}
+
+// OnChange set the function called after a fake ip is allocated or the pool is cleared
+func (p *Pool) OnChange(f func()) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.onChange = f
+}
+
 // Gateway return gateway ip
 func (p *Pool) Gateway() net.IP {
-	return uintToIP(p.gateway)
+	return append(net.IP{}, p.gateway...)
 }
 
+// get allocate the next free offset after the last one, the last one is reused if all are taken
 func (p *Pool) get(host string) net.IP {
-	current := p.offset
-	for {
-		p.offset = (p.offset + 1) % (p.max - p.min)
-		// Avoid infinite loops
-		if p.offset == current {
-			break
-		}
-
+	for i := uint32(0); i < p.span; i++ {
+		p.offset = p.offset%p.span + 1
 		if !p.cache.Exist(p.offset) {
 			break
 		}
 	}
-	ip := uintToIP(p.min + p.offset - 1)
+	ip := p.offsetToIP(p.offset)
 	p.cache.Set(p.offset, host)
 	return ip
 }
 
-func ipToUint(ip net.IP) uint32 {
-	v := uint32(ip[0]) << 24
-	v += uint32(ip[1]) << 16
-	v += uint32(ip[2]) << 8
-	v += uint32(ip[3])
-	return v
+// normalize return ip in the length of the pool, nil if it is of the other family
+func (p *Pool) normalize(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		if p.IPv6() {
+			return nil
+		}
+		return ip4
+	}
+
+	if !p.IPv6() {
+		return nil
+	}
+	return ip.To16()
+}
+
+func (p *Pool) ipToOffset(ip net.IP) uint32 {
+	n := new(big.Int).Sub(ipToInt(ip), p.min)
+	return uint32(n.Int64() + 1)
+}
+
+func (p *Pool) offsetToIP(offset uint32) net.IP {
+	n := new(big.Int).Add(p.min, big.NewInt(int64(offset)-1))
+	return p.intToIP(n)
 }
 
-func uintToIP(v uint32) net.IP {
-	return net.IPv4(byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+func (p *Pool) intToIP(n *big.Int) net.IP {
+	ip := make(net.IP, p.ipLen)
+	buf := n.Bytes()
+	copy(ip[p.ipLen-len(buf):], buf)
+	return ip
+}
+
+func ipToInt(ip net.IP) *big.Int {
+	return new(big.Int).SetBytes(ip)
 }
 
 // New return Pool instance
 func New(ipnet *net.IPNet, size int) (*Pool, error) {
-	min := ipToUint(ipnet.IP) + 2
+	ip := ipnet.IP.To4()
+	if ip == nil {
+		ip = ipnet.IP.To16()
+	}
 
 	ones, bits := ipnet.Mask.Size()
-	total := 1<<uint(bits-ones) - 2
-
-	if total <= 0 {
+	hostBits := bits - ones
+	if ip == nil || bits != len(ip)*8 || hostBits < 2 {
 		return nil, errors.New("ipnet don't have valid ip")
 	}
 
-	max := min + uint32(total) - 1
-	return &Pool{
-		min:     min,
-		max:     max,
-		gateway: min - 1,
-		mux:     &sync.Mutex{},
-		cache:   cache.NewLRUCache(cache.WithSize(size * 2)),
-	}, nil
+	// the count of usable ips, excluding the network address and the gateway
+	total := uint64(math.MaxUint32)
+	if hostBits <= 32 {
+		total = 1<<uint(hostBits) - 2
+	}
+
+	min := new(big.Int).Add(ipToInt(ip), big.NewInt(2))
+	max := new(big.Int).Add(min, new(big.Int).SetUint64(total-1))
+	pool := &Pool{
+		min:   min,
+		span:  uint32(total - 1),
+		ipLen: len(ip),
+		ipnet: ipnet,
+		size:  size,
+		mux:   &sync.Mutex{},
+		cache: cache.NewLRUCache(cache.WithSize(size * 2)),
+	}
+	pool.gateway = pool.intToIP(new(big.Int).Sub(min, big.NewInt(1)))
+	pool.max = pool.intToIP(max)
+	return pool, nil
 }
@@ -1,6 +1,7 @@
 package fakeip
 
 import (
+	"fmt"
 	"net"
 	"testing"
 
@@ -28,6 +29,7 @@ func TestPool_Cycle(t *testing.T) {
 	first := pool.Lookup("foo.com")
 	same := pool.Lookup("baz.com")
 
+	assert.True(t, first.Equal(net.IP{192, 168, 0, 2}))
 	assert.True(t, first.Equal(same))
 }
 
@@ -70,9 +72,71 @@ func TestPool_DoubleMapping(t *testing.T) {
 	assert.False(t, bazIP.Equal(newBazIP))
 }
 
+func TestPool_Contains(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("192.168.0.1/29")
+	pool, _ := New(ipnet, 10)
+
+	assert.True(t, pool.Contains(pool.Lookup("foo.com")))
+	assert.True(t, pool.Contains(net.IP{192, 168, 0, 7}))
+	assert.False(t, pool.Contains(net.IP{192, 168, 0, 8}))
+	assert.False(t, pool.Contains(net.ParseIP("::1")))
+}
+
+func TestPool_IPv6(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("fdfe:dcba:9876::1/64")
+	pool, err := New(ipnet, 10)
+	assert.Nil(t, err)
+
+	first := pool.Lookup("foo.com")
+	last := pool.Lookup("bar.com")
+	bar, exist := pool.LookBack(last)
+
+	assert.True(t, first.Equal(net.ParseIP("fdfe:dcba:9876::2")))
+	assert.True(t, last.Equal(net.ParseIP("fdfe:dcba:9876::3")))
+	assert.True(t, pool.Gateway().Equal(net.ParseIP("fdfe:dcba:9876::1")))
+	assert.True(t, exist)
+	assert.Equal(t, bar, "bar.com")
+
+	assert.True(t, pool.Contains(net.ParseIP("fdfe:dcba:9876::1:0:0")))
+	assert.False(t, pool.Contains(net.ParseIP("fdfe:dcba:9877::2")))
+	assert.False(t, pool.Contains(net.IP{198, 18, 0, 2}))
+	_, exist = pool.LookBack(net.IP{0, 0, 0, 3})
+	assert.False(t, exist)
+}
+
+func TestPool_IPv6Cycle(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("fdfe:dcba:9876::/126")
+	pool, _ := New(ipnet, 10)
+
+	first := pool.Lookup("foo.com")
+	same := pool.Lookup("baz.com")
+
+	// the gateway is never allocated
+	assert.True(t, first.Equal(net.ParseIP("fdfe:dcba:9876::2")))
+	assert.True(t, first.Equal(same))
+}
+
+func TestPool_CycleSkipGateway(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("192.168.0.1/29")
+	pool, _ := New(ipnet, 10)
+
+	hosts := map[string]bool{}
+	for i := 0; i < 12; i++ {
+		ip := pool.Lookup(fmt.Sprintf("%d.example.com", i))
+		assert.False(t, ip.Equal(pool.Gateway()))
+		hosts[ip.String()] = true
+	}
+	assert.Len(t, hosts, 5)
+}
+
 func TestPool_Error(t *testing.T) {
 	_, ipnet, _ := net.ParseCIDR("192.168.0.1/31")
 	_, err := New(ipnet, 10)
 
 	assert.Error(t, err)
+
+	_, ipnet, _ = net.ParseCIDR("fdfe:dcba:9876::1/127")
+	_, err = New(ipnet, 10)
+
+	assert.Error(t, err)
 }
@@ -0,0 +1,218 @@
+package health
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWindow    = time.Minute
+	defaultThreshold = 5
+	defaultCooldown  = 30 * time.Second
+)
+
+// State is the passive health state of a proxy
+type State int
+
+const (
+	// Healthy proxies receive traffic
+	Healthy State = iota
+	// Unhealthy proxies are skipped until the cooldown ends
+	Unhealthy
+	// HalfOpen proxies receive a single trial connection, its result decides the state
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Healthy:
+		return "healthy"
+	case Unhealthy:
+		return "unhealthy"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalJSON serialize State
+func (s State) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Kind is the kind of a failure observed from real traffic
+type Kind int
+
+const (
+	// DialFailure is a failed dial to the proxy
+	DialFailure Kind = iota
+	// Timeout is a dial or handshake exceeding the deadline
+	Timeout
+	// EarlyReset is a connection closed before receiving any byte
+	EarlyReset
+)
+
+func (k Kind) String() string {
+	switch k {
+	case DialFailure:
+		return "dial"
+	case Timeout:
+		return "timeout"
+	case EarlyReset:
+		return "reset"
+	default:
+		return "unknown"
+	}
+}
+
+// Option is the options of Tracker
+type Option struct {
+	// Window is the sliding window failures are counted in
+	Window time.Duration
+	// Threshold is the number of failures in the window making a proxy unhealthy
+	Threshold int
+	// Cooldown is how long a proxy stays unhealthy before the half-open probe
+	Cooldown time.Duration
+}
+
+type failure struct {
+	time time.Time
+	kind Kind
+}
+
+// Snapshot is the state of a Tracker reported by the API
+type Snapshot struct {
+	State    State          `json:"state"`
+	Failures map[string]int `json:"failures"`
+}
+
+// Tracker is a circuit breaker fed by the results of real connections
+type Tracker struct {
+	option Option
+
+	mux      sync.Mutex
+	state    State
+	since    time.Time
+	failures []failure
+	// trial is the start of the half-open trial connection, zero if none is in flight
+	trial time.Time
+}
+
+// Available return false while the proxy is unhealthy or its half-open trial is in flight,
+// it turns into half-open once the cooldown ends.
+func (t *Tracker) Available() bool {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.update(time.Now())
+	return t.state == Healthy || (t.state == HalfOpen && t.trial.IsZero())
+}
+
+// Attempt record the start of a connection, in half-open state it becomes the trial
+// and the proxy is unavailable until its result is recorded
+func (t *Tracker) Attempt() {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	now := time.Now()
+	t.update(now)
+	if t.state == HalfOpen && t.trial.IsZero() {
+		t.trial = now
+	}
+}
+
+// update turn an unhealthy proxy into half-open once the cooldown ends,
+// a trial without result for a cooldown is dropped so that another one is admitted
+func (t *Tracker) update(now time.Time) {
+	switch t.state {
+	case Unhealthy:
+		if now.Sub(t.since) >= t.option.Cooldown {
+			t.state = HalfOpen
+			t.since = now
+			t.trial = time.Time{}
+		}
+	case HalfOpen:
+		if !t.trial.IsZero() && now.Sub(t.trial) >= t.option.Cooldown {
+			t.trial = time.Time{}
+		}
+	}
+}
+
+// Success record a working connection or a successful active probe, it makes the proxy healthy
+func (t *Tracker) Success() {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if t.state != Healthy {
+		t.state = Healthy
+		t.since = time.Now()
+		t.failures = nil
+		t.trial = time.Time{}
+	}
+}
+
+// Failure record a failure, the proxy becomes unhealthy past the threshold
+func (t *Tracker) Failure(kind Kind) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	now := time.Now()
+	switch t.state {
+	case Unhealthy:
+		// don't extend the cooldown by the traffic still sent to it
+		return
+	case HalfOpen:
+		t.state = Unhealthy
+		t.since = now
+		t.trial = time.Time{}
+		return
+	}
+
+	t.expire(now)
+	t.failures = append(t.failures, failure{time: now, kind: kind})
+	if len(t.failures) >= t.option.Threshold {
+		t.state = Unhealthy
+		t.since = now
+	}
+}
+
+// expire drop the failures out of the window
+func (t *Tracker) expire(now time.Time) {
+	i := 0
+	for ; i < len(t.failures); i++ {
+		if now.Sub(t.failures[i].time) < t.option.Window {
+			break
+		}
+	}
+	t.failures = t.failures[i:]
+}
+
+// Snapshot return the state and the failures in the window by kind
+func (t *Tracker) Snapshot() Snapshot {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.expire(time.Now())
+	failures := map[string]int{}
+	for _, f := range t.failures {
+		failures[f.kind.String()]++
+	}
+	return Snapshot{State: t.state, Failures: failures}
+}
+
+// NewTracker return a healthy Tracker, zero fields of option are set to the defaults
+func NewTracker(option Option) *Tracker {
+	if option.Window <= 0 {
+		option.Window = defaultWindow
+	}
+	if option.Threshold <= 0 {
+		option.Threshold = defaultThreshold
+	}
+	if option.Cooldown <= 0 {
+		option.Cooldown = defaultCooldown
+	}
+
+	return &Tracker{option: option, state: Healthy}
+}
@@ -0,0 +1,85 @@
+package health
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker_Threshold(t *testing.T) {
+	tracker := NewTracker(Option{Threshold: 3, Cooldown: time.Hour})
+
+	tracker.Failure(DialFailure)
+	tracker.Failure(Timeout)
+	assert.True(t, tracker.Available())
+
+	tracker.Failure(EarlyReset)
+	assert.False(t, tracker.Available())
+
+	snapshot := tracker.Snapshot()
+	assert.Equal(t, Unhealthy, snapshot.State)
+	assert.Equal(t, map[string]int{"dial": 1, "timeout": 1, "reset": 1}, snapshot.Failures)
+}
+
+func TestTracker_Window(t *testing.T) {
+	tracker := NewTracker(Option{Window: 50 * time.Millisecond, Threshold: 2})
+
+	tracker.Failure(DialFailure)
+	time.Sleep(100 * time.Millisecond)
+	tracker.Failure(DialFailure)
+	assert.True(t, tracker.Available())
+	assert.Equal(t, 1, tracker.Snapshot().Failures["dial"])
+}
+
+func TestTracker_HalfOpen(t *testing.T) {
+	tracker := NewTracker(Option{Threshold: 1, Cooldown: 50 * time.Millisecond})
+
+	tracker.Failure(DialFailure)
+	assert.False(t, tracker.Available())
+
+	// a failed trial goes back to unhealthy
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, tracker.Available())
+	assert.Equal(t, HalfOpen, tracker.Snapshot().State)
+	tracker.Attempt()
+	tracker.Failure(EarlyReset)
+	assert.False(t, tracker.Available())
+
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, tracker.Available())
+	tracker.Success()
+	assert.Equal(t, Healthy, tracker.Snapshot().State)
+	assert.Empty(t, tracker.Snapshot().Failures)
+}
+
+func TestTracker_SingleTrial(t *testing.T) {
+	tracker := NewTracker(Option{Threshold: 1, Cooldown: 50 * time.Millisecond})
+	tracker.Failure(DialFailure)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, tracker.Available())
+	tracker.Attempt()
+	// only the trial is admitted until its result
+	assert.False(t, tracker.Available())
+	assert.Equal(t, HalfOpen, tracker.Snapshot().State)
+
+	// a trial without result is dropped after the cooldown
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, tracker.Available())
+	tracker.Attempt()
+	tracker.Success()
+	assert.True(t, tracker.Available())
+	assert.Equal(t, Healthy, tracker.Snapshot().State)
+}
+
+func TestTracker_SuccessRecover(t *testing.T) {
+	tracker := NewTracker(Option{Threshold: 1, Cooldown: time.Hour})
+	tracker.Failure(DialFailure)
+	assert.False(t, tracker.Available())
+
+	// e.g. a successful active probe
+	tracker.Success()
+	assert.True(t, tracker.Available())
+	assert.Equal(t, Healthy, tracker.Snapshot().State)
+}
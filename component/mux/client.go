@@ -0,0 +1,174 @@
+package mux
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultConcurrency = 8
+	defaultKeepAlive   = 30 * time.Second
+	defaultIdleTimeout = 60 * time.Second
+)
+
+// DialFunc establish an underlying connection of a session,
+// e.g. a websocket of v2ray-plugin or a vmess connection with mux command.
+type DialFunc func(ctx context.Context) (net.Conn, error)
+
+// Option is the options of Client
+type Option struct {
+	// Concurrency is the max streams opened on one underlying connection
+	Concurrency int
+	// KeepAlive is the interval of keep-alive frames on an idle connection
+	KeepAlive time.Duration
+	// IdleTimeout closes the underlying connection without streams
+	IdleTimeout time.Duration
+}
+
+// Client keeps a pool of long-lived sessions and opens streams on them
+type Client struct {
+	dial   DialFunc
+	option Option
+
+	mux      sync.Mutex
+	sessions []*Session
+	done     chan struct{}
+	closed   bool
+}
+
+// DialContext open a stream to host:port, a new session is established when all are full
+func (c *Client) DialContext(ctx context.Context, network, host string, port uint16) (net.Conn, error) {
+	// the picked session may be filled up by others at the same time, so try a few times
+	for i := 0; i < 3; i++ {
+		session := c.pick()
+		if session == nil {
+			break
+		}
+
+		stream, err := session.openStream(network, host, port, c.option.Concurrency)
+		if err == nil {
+			return stream, nil
+		}
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	session := NewSession(conn, c.option.KeepAlive)
+	c.mux.Lock()
+	if c.closed {
+		c.mux.Unlock()
+		session.Close()
+		return nil, ErrSessionClosed
+	}
+	c.sessions = append(c.sessions, session)
+	c.mux.Unlock()
+
+	return session.openStream(network, host, port, c.option.Concurrency)
+}
+
+// pick return the busiest session which is not full, so that idle sessions can be released,
+// a blocked session is skipped since a new stream on it would wait for the full one
+func (c *Client) pick() *Session {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	var picked *Session
+	pickedActive := -1
+	for _, session := range c.sessions {
+		if session.IsClosed() || session.Blocked() {
+			continue
+		}
+
+		active := session.Active()
+		if active < c.option.Concurrency && active > pickedActive {
+			picked = session
+			pickedActive = active
+		}
+	}
+	return picked
+}
+
+// Sessions return the number of alive underlying connections
+func (c *Client) Sessions() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	n := 0
+	for _, session := range c.sessions {
+		if !session.IsClosed() {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *Client) cleanup() {
+	ticker := time.NewTicker(c.option.IdleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.mux.Lock()
+			sessions := c.sessions[:0]
+			for _, session := range c.sessions {
+				idleSince := session.IdleSince()
+				if !idleSince.IsZero() && time.Since(idleSince) > c.option.IdleTimeout {
+					session.Close()
+				}
+
+				if !session.IsClosed() {
+					sessions = append(sessions, session)
+				}
+			}
+			c.sessions = sessions
+			c.mux.Unlock()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Close all sessions of the pool
+func (c *Client) Close() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+
+	for _, session := range c.sessions {
+		session.Close()
+	}
+	c.sessions = nil
+	return nil
+}
+
+// NewClient return a Client, zero fields of option are set to the defaults
+func NewClient(dial DialFunc, option Option) *Client {
+	if option.Concurrency <= 0 {
+		option.Concurrency = defaultConcurrency
+	}
+	if option.KeepAlive <= 0 {
+		option.KeepAlive = defaultKeepAlive
+	}
+	if option.IdleTimeout <= 0 {
+		option.IdleTimeout = defaultIdleTimeout
+	}
+
+	c := &Client{
+		dial:   dial,
+		option: option,
+		done:   make(chan struct{}),
+	}
+	go c.cleanup()
+	return c
+}
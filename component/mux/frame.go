@@ -0,0 +1,137 @@
+package mux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+)
+
+// Session status of Mux.Cool frames
+const (
+	StatusNew       byte = 0x01
+	StatusKeep      byte = 0x02
+	StatusEnd       byte = 0x03
+	StatusKeepAlive byte = 0x04
+)
+
+// Options of Mux.Cool frames
+const (
+	OptionNone  byte = 0x00
+	OptionData  byte = 0x01
+	OptionError byte = 0x02
+)
+
+// Network types in the metadata of a new session
+const (
+	NetworkTCP byte = 0x01
+	NetworkUDP byte = 0x02
+)
+
+// Address types in the metadata of a new session
+const (
+	AtypIPv4       byte = 0x01
+	AtypDomainName byte = 0x02
+	AtypIPv6       byte = 0x03
+)
+
+const (
+	maxMetadataSize = 512
+	maxChunkSize    = 16 * 1024
+)
+
+var errBadFrame = errors.New("mux: bad frame")
+
+type frame struct {
+	id      uint16
+	status  byte
+	option  byte
+	payload []byte
+}
+
+// appendAddress append network, port and address of a new session to buf
+func appendAddress(buf *bytes.Buffer, network string, host string, port uint16) error {
+	if network == "udp" {
+		buf.WriteByte(NetworkUDP)
+	} else {
+		buf.WriteByte(NetworkTCP)
+	}
+	binary.Write(buf, binary.BigEndian, port)
+
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		if len(host) > 255 {
+			return errors.New("mux: domain name too long")
+		}
+		buf.WriteByte(AtypDomainName)
+		buf.WriteByte(byte(len(host)))
+		buf.WriteString(host)
+	case ip.To4() != nil:
+		buf.WriteByte(AtypIPv4)
+		buf.Write(ip.To4())
+	default:
+		buf.WriteByte(AtypIPv6)
+		buf.Write(ip.To16())
+	}
+	return nil
+}
+
+// encodeFrame build a frame, extra is appended to the metadata of a new session
+func encodeFrame(id uint16, status, option byte, extra []byte, payload []byte) []byte {
+	metaLen := 4 + len(extra)
+	size := 2 + metaLen
+	if option&OptionData != 0 {
+		size += 2 + len(payload)
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint16(buf, uint16(metaLen))
+	binary.BigEndian.PutUint16(buf[2:], id)
+	buf[4] = status
+	buf[5] = option
+	copy(buf[6:], extra)
+
+	if option&OptionData != 0 {
+		offset := 2 + metaLen
+		binary.BigEndian.PutUint16(buf[offset:], uint16(len(payload)))
+		copy(buf[offset+2:], payload)
+	}
+	return buf
+}
+
+func readFrame(r io.Reader) (*frame, error) {
+	var lenBuf [2]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+
+	metaLen := int(binary.BigEndian.Uint16(lenBuf[:]))
+	if metaLen < 4 || metaLen > maxMetadataSize {
+		return nil, errBadFrame
+	}
+
+	meta := make([]byte, metaLen)
+	if _, err := io.ReadFull(r, meta); err != nil {
+		return nil, err
+	}
+
+	f := &frame{
+		id:     binary.BigEndian.Uint16(meta),
+		status: meta[2],
+		option: meta[3],
+	}
+
+	if f.option&OptionData != 0 {
+		if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+			return nil, err
+		}
+		f.payload = make([]byte, binary.BigEndian.Uint16(lenBuf[:]))
+		if _, err := io.ReadFull(r, f.payload); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
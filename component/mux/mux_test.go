@@ -0,0 +1,283 @@
+package mux
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serve is a minimal Mux.Cool server, it echoes every stream
+func serve(conn net.Conn) {
+	defer conn.Close()
+	var wmux sync.Mutex
+	write := func(b []byte) {
+		wmux.Lock()
+		defer wmux.Unlock()
+		conn.Write(b)
+	}
+
+	for {
+		f, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+
+		switch f.status {
+		case StatusKeep:
+			if f.option&OptionData != 0 {
+				write(encodeFrame(f.id, StatusKeep, OptionData, nil, f.payload))
+			}
+		case StatusEnd:
+			write(encodeFrame(f.id, StatusEnd, OptionNone, nil, nil))
+		}
+	}
+}
+
+func newTestClient(option Option) (*Client, *int32) {
+	dials := new(int32)
+	return NewClient(func(ctx context.Context) (net.Conn, error) {
+		atomic.AddInt32(dials, 1)
+		client, server := net.Pipe()
+		go serve(server)
+		return client, nil
+	}, option), dials
+}
+
+func TestFrame_NewSession(t *testing.T) {
+	extra := &bytes.Buffer{}
+	assert.Nil(t, appendAddress(extra, "tcp", "example.com", 443))
+
+	f, err := readFrame(bytes.NewReader(encodeFrame(1, StatusNew, OptionNone, extra.Bytes(), nil)))
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(1), f.id)
+	assert.Equal(t, StatusNew, f.status)
+
+	_, err = readFrame(bytes.NewReader([]byte{0, 1, 0}))
+	assert.Equal(t, errBadFrame, err)
+}
+
+func TestClient_Echo(t *testing.T) {
+	client, dials := newTestClient(Option{Concurrency: 4})
+	defer client.Close()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := client.DialContext(context.Background(), "tcp", "127.0.0.1", 80)
+			if !assert.Nil(t, err) {
+				return
+			}
+			defer c.Close()
+
+			// larger than a chunk
+			payload := bytes.Repeat([]byte{'a'}, maxChunkSize*2+1)
+			go c.Write(payload)
+
+			buf := make([]byte, len(payload))
+			_, err = io.ReadFull(c, buf)
+			assert.Nil(t, err)
+			assert.Equal(t, payload, buf)
+		}()
+	}
+	wg.Wait()
+
+	assert.True(t, atomic.LoadInt32(dials) >= 1)
+	assert.Equal(t, 0, client.sessions[0].Active())
+}
+
+func TestClient_Concurrency(t *testing.T) {
+	client, dials := newTestClient(Option{Concurrency: 2})
+	defer client.Close()
+
+	conns := []net.Conn{}
+	for i := 0; i < 5; i++ {
+		c, err := client.DialContext(context.Background(), "tcp", "example.com", 443)
+		assert.Nil(t, err)
+		conns = append(conns, c)
+	}
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(dials))
+	assert.Equal(t, 3, client.Sessions())
+
+	for _, c := range conns {
+		c.Close()
+	}
+
+	// reuse the pool
+	c, err := client.DialContext(context.Background(), "tcp", "example.com", 443)
+	assert.Nil(t, err)
+	c.Close()
+	assert.Equal(t, int32(3), atomic.LoadInt32(dials))
+}
+
+func TestClient_IdleTimeout(t *testing.T) {
+	client, _ := newTestClient(Option{IdleTimeout: 100 * time.Millisecond})
+	defer client.Close()
+
+	c, err := client.DialContext(context.Background(), "tcp", "example.com", 443)
+	assert.Nil(t, err)
+	c.Close()
+
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, 0, client.Sessions())
+}
+
+func TestStream_RemoteEnd(t *testing.T) {
+	client, server := net.Pipe()
+	session := NewSession(client, 0)
+	defer session.Close()
+
+	go func() {
+		f, _ := readFrame(server)
+		server.Write(encodeFrame(f.id, StatusKeep, OptionData, nil, []byte("bye")))
+		server.Write(encodeFrame(f.id, StatusEnd, OptionNone, nil, nil))
+		io.Copy(ioutil.Discard, server)
+	}()
+
+	stream, err := session.OpenStream("tcp", "example.com", 80)
+	assert.Nil(t, err)
+
+	buf, err := ioutil.ReadAll(stream)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bye"), buf)
+	stream.Close()
+}
+
+func TestStream_ReadDeadline(t *testing.T) {
+	client, _ := newTestClient(Option{})
+	defer client.Close()
+
+	c, err := client.DialContext(context.Background(), "tcp", "example.com", 443)
+	assert.Nil(t, err)
+	defer c.Close()
+
+	c.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err = c.Read(make([]byte, 1))
+	netErr, ok := err.(net.Error)
+	assert.True(t, ok && netErr.Timeout())
+}
+
+func TestSession_CloseWakeReader(t *testing.T) {
+	client, server := net.Pipe()
+	go io.Copy(ioutil.Discard, server)
+	session := NewSession(client, 0)
+
+	stream, err := session.OpenStream("tcp", "example.com", 80)
+	assert.Nil(t, err)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		session.Close()
+	}()
+
+	_, err = stream.Read(make([]byte, 1))
+	assert.Equal(t, ErrSessionClosed, err)
+}
+
+func TestSession_Backpressure(t *testing.T) {
+	client, server := net.Pipe()
+	session := NewSession(client, 0)
+	defer session.Close()
+
+	frames := make(chan *frame, 16)
+	go func() {
+		for {
+			f, err := readFrame(server)
+			if err != nil {
+				return
+			}
+			if f.status == StatusEnd {
+				frames <- f
+			}
+		}
+	}()
+
+	stalled, err := session.OpenStream("tcp", "example.com", 80)
+	assert.Nil(t, err)
+	defer stalled.Close()
+	active, err := session.OpenStream("tcp", "example.com", 443)
+	assert.Nil(t, err)
+	defer active.Close()
+
+	// send twice maxBufferSize to the stalled stream before anything is read, then to the active one
+	payload := make([]byte, 2*maxBufferSize)
+	for i := range payload {
+		payload[i] = byte(i / maxChunkSize)
+	}
+	go func() {
+		for b := payload; len(b) > 0; b = b[maxChunkSize:] {
+			server.Write(encodeFrame(stalled.id, StatusKeep, OptionData, nil, b[:maxChunkSize]))
+		}
+		server.Write(encodeFrame(active.id, StatusKeep, OptionData, nil, []byte("hello")))
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for !session.Blocked() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, session.Blocked())
+
+	// no new stream is put on the blocked session
+	pool := &Client{option: Option{Concurrency: defaultConcurrency}, sessions: []*Session{session}}
+	assert.Nil(t, pool.pick())
+
+	stalled.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, len(payload))
+	_, err = io.ReadFull(stalled, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, buf)
+
+	active.SetReadDeadline(time.Now().Add(time.Second))
+	buf = make([]byte, 5)
+	_, err = io.ReadFull(active, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello"), buf)
+	assert.False(t, session.Blocked())
+
+	select {
+	case f := <-frames:
+		assert.FailNow(t, "a stream is ended", "stream %d", f.id)
+	default:
+	}
+}
+
+func TestSession_CloseBlockedStream(t *testing.T) {
+	client, server := net.Pipe()
+	session := NewSession(client, 0)
+	defer session.Close()
+	go io.Copy(ioutil.Discard, server)
+
+	stalled, err := session.OpenStream("tcp", "example.com", 80)
+	assert.Nil(t, err)
+	active, err := session.OpenStream("tcp", "example.com", 443)
+	assert.Nil(t, err)
+	defer active.Close()
+
+	go func() {
+		chunk := bytes.Repeat([]byte{'a'}, maxChunkSize)
+		for i := 0; i <= maxBufferSize/maxChunkSize; i++ {
+			server.Write(encodeFrame(stalled.id, StatusKeep, OptionData, nil, chunk))
+		}
+		server.Write(encodeFrame(active.id, StatusKeep, OptionData, nil, []byte("hello")))
+	}()
+
+	// closing the full stream releases the session
+	time.Sleep(50 * time.Millisecond)
+	stalled.Close()
+
+	active.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(active, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello"), buf)
+}
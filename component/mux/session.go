@@ -0,0 +1,454 @@
+package mux
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxBufferSize is the receive window of a stream, Mux.Cool has no window update,
+// so the session stops reading the underlying connection while a stream is full.
+const maxBufferSize = 512 * 1024
+
+var (
+	ErrSessionClosed = errors.New("mux: session closed")
+	ErrStreamClosed  = errors.New("mux: stream closed")
+	ErrStreamReset   = errors.New("mux: stream reset by peer")
+	ErrTooManyStream = errors.New("mux: too many streams")
+	errTimeout       = &timeoutError{}
+)
+
+type timeoutError struct{}
+
+func (e *timeoutError) Error() string   { return "mux: i/o timeout" }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+// Session is a Mux.Cool client over a single underlying connection
+type Session struct {
+	conn net.Conn
+
+	wmux      sync.Mutex
+	lastWrite time.Time
+
+	mux       sync.Mutex
+	streams   map[uint16]*Stream
+	nextID    uint16
+	active    int
+	idleSince time.Time
+	// blocked is true while the session waits for a full stream to be read
+	blocked bool
+
+	die     chan struct{}
+	dieOnce sync.Once
+}
+
+// NewSession start a client session on conn, keepAlive is the interval of keep-alive frames
+func NewSession(conn net.Conn, keepAlive time.Duration) *Session {
+	s := &Session{
+		conn:      conn,
+		streams:   map[uint16]*Stream{},
+		idleSince: time.Now(),
+		die:       make(chan struct{}),
+	}
+
+	go s.recvLoop()
+	if keepAlive > 0 {
+		go s.keepAliveLoop(keepAlive)
+	}
+	return s
+}
+
+// OpenStream create a logical stream to host:port
+func (s *Session) OpenStream(network, host string, port uint16) (*Stream, error) {
+	return s.openStream(network, host, port, 0)
+}
+
+// openStream fail with ErrTooManyStream if there are already max streams, zero means no limit
+func (s *Session) openStream(network, host string, port uint16, max int) (*Stream, error) {
+	extra := &bytes.Buffer{}
+	if err := appendAddress(extra, network, host, port); err != nil {
+		return nil, err
+	}
+
+	s.mux.Lock()
+	if s.IsClosed() {
+		s.mux.Unlock()
+		return nil, ErrSessionClosed
+	}
+
+	if max > 0 && s.active >= max {
+		s.mux.Unlock()
+		return nil, ErrTooManyStream
+	}
+
+	var id uint16
+	for i := 0; i < 0xFFFF; i++ {
+		s.nextID++
+		if s.nextID == 0 {
+			s.nextID++
+		}
+		if _, exist := s.streams[s.nextID]; !exist {
+			id = s.nextID
+			break
+		}
+	}
+	if id == 0 {
+		s.mux.Unlock()
+		return nil, ErrTooManyStream
+	}
+
+	stream := newStream(id, s)
+	s.streams[id] = stream
+	s.active++
+	s.mux.Unlock()
+
+	if err := s.writeFrame(encodeFrame(id, StatusNew, OptionNone, extra.Bytes(), nil)); err != nil {
+		stream.Close()
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Active return the number of opened streams
+func (s *Session) Active() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.active
+}
+
+// IdleSince return the time since when no stream is opened, it is zero when the session is in use
+func (s *Session) IdleSince() time.Time {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.active != 0 {
+		return time.Time{}
+	}
+	return s.idleSince
+}
+
+// Blocked return true if the session is waiting for a full stream to be read,
+// the other streams of the session receive nothing in the meantime
+func (s *Session) Blocked() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.blocked
+}
+
+func (s *Session) setBlocked(blocked bool) {
+	s.mux.Lock()
+	s.blocked = blocked
+	s.mux.Unlock()
+}
+
+// IsClosed return true if the underlying connection is closed
+func (s *Session) IsClosed() bool {
+	select {
+	case <-s.die:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close the session and all of its streams
+func (s *Session) Close() error {
+	var err error
+	s.dieOnce.Do(func() {
+		close(s.die)
+		err = s.conn.Close()
+	})
+	return err
+}
+
+func (s *Session) writeFrame(b []byte) error {
+	s.wmux.Lock()
+	defer s.wmux.Unlock()
+
+	if s.IsClosed() {
+		return ErrSessionClosed
+	}
+
+	if _, err := s.conn.Write(b); err != nil {
+		s.Close()
+		return err
+	}
+	s.lastWrite = time.Now()
+	return nil
+}
+
+func (s *Session) removeStream(id uint16) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if _, exist := s.streams[id]; !exist {
+		return
+	}
+	delete(s.streams, id)
+	s.active--
+	if s.active == 0 {
+		s.idleSince = time.Now()
+	}
+}
+
+func (s *Session) getStream(id uint16) *Stream {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.streams[id]
+}
+
+func (s *Session) recvLoop() {
+	defer s.Close()
+
+	for {
+		f, err := readFrame(s.conn)
+		if err != nil {
+			return
+		}
+
+		switch f.status {
+		case StatusKeep:
+			if stream := s.getStream(f.id); stream != nil {
+				stream.push(f.payload)
+			} else if f.id != 0 {
+				// the stream is gone, tell the peer to stop sending
+				s.writeFrame(encodeFrame(f.id, StatusEnd, OptionNone, nil, nil))
+			}
+		case StatusEnd:
+			if stream := s.getStream(f.id); stream != nil {
+				stream.remoteClose(f.option&OptionError != 0)
+			}
+		case StatusNew, StatusKeepAlive:
+			// a client never accept new streams
+		default:
+			return
+		}
+	}
+}
+
+func (s *Session) keepAliveLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.wmux.Lock()
+			idle := time.Since(s.lastWrite) >= interval
+			s.wmux.Unlock()
+
+			if idle {
+				if err := s.writeFrame(encodeFrame(0, StatusKeepAlive, OptionNone, nil, nil)); err != nil {
+					return
+				}
+			}
+		case <-s.die:
+			return
+		}
+	}
+}
+
+// Stream is a logical connection of a Session
+type Stream struct {
+	id      uint16
+	session *Session
+
+	mux          sync.Mutex
+	buf          []byte
+	remoteClosed bool
+	// closeErr is returned by Read once the buffer is drained after remoteClosed, nil means io.EOF
+	closeErr     error
+	readDeadline time.Time
+
+	// notify wakes up the reader, space wakes up the session pushing data
+	notify chan struct{}
+	space  chan struct{}
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newStream(id uint16, session *Session) *Stream {
+	return &Stream{
+		id:      id,
+		session: session,
+		notify:  make(chan struct{}, 1),
+		space:   make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+	}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// push append b to the receive buffer, it waits while the buffer is full,
+// b is dropped only if the stream or the session is closed meanwhile
+func (st *Stream) push(b []byte) {
+	for {
+		st.mux.Lock()
+		if st.isClosed() || st.remoteClosed {
+			st.mux.Unlock()
+			return
+		}
+
+		if len(st.buf) < maxBufferSize {
+			st.buf = append(st.buf, b...)
+			st.mux.Unlock()
+			signal(st.notify)
+			return
+		}
+		st.mux.Unlock()
+
+		st.session.setBlocked(true)
+		select {
+		case <-st.space:
+		case <-st.closed:
+		case <-st.session.die:
+		}
+		st.session.setBlocked(false)
+	}
+}
+
+func (st *Stream) remoteClose(reset bool) {
+	st.mux.Lock()
+	st.remoteClosed = true
+	if reset {
+		st.closeErr = ErrStreamReset
+	}
+	st.mux.Unlock()
+	signal(st.notify)
+}
+
+func (st *Stream) isClosed() bool {
+	select {
+	case <-st.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (st *Stream) Read(b []byte) (int, error) {
+	for {
+		st.mux.Lock()
+		if len(st.buf) != 0 {
+			n := copy(b, st.buf)
+			st.buf = st.buf[n:]
+			if len(st.buf) == 0 {
+				st.buf = nil
+			}
+			st.mux.Unlock()
+			signal(st.space)
+			return n, nil
+		}
+
+		if st.isClosed() {
+			st.mux.Unlock()
+			return 0, ErrStreamClosed
+		}
+
+		if st.remoteClosed {
+			err := st.closeErr
+			st.mux.Unlock()
+			if err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !st.readDeadline.IsZero() {
+			d := time.Until(st.readDeadline)
+			if d <= 0 {
+				st.mux.Unlock()
+				return 0, errTimeout
+			}
+			timer = time.NewTimer(d)
+			timeout = timer.C
+		}
+		st.mux.Unlock()
+
+		select {
+		case <-st.notify:
+		case <-timeout:
+		case <-st.closed:
+		case <-st.session.die:
+			return 0, ErrSessionClosed
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (st *Stream) Write(b []byte) (int, error) {
+	n := 0
+	for len(b) > 0 {
+		st.mux.Lock()
+		closed := st.isClosed() || st.remoteClosed
+		st.mux.Unlock()
+		if closed {
+			return n, ErrStreamClosed
+		}
+
+		chunk := b
+		if len(chunk) > maxChunkSize {
+			chunk = chunk[:maxChunkSize]
+		}
+
+		if err := st.session.writeFrame(encodeFrame(st.id, StatusKeep, OptionData, nil, chunk)); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		b = b[len(chunk):]
+	}
+	return n, nil
+}
+
+// Close the stream and notify the peer
+func (st *Stream) Close() error {
+	var err error
+	st.closeOnce.Do(func() {
+		close(st.closed)
+		st.session.removeStream(st.id)
+		err = st.session.writeFrame(encodeFrame(st.id, StatusEnd, OptionNone, nil, nil))
+		if err == ErrSessionClosed {
+			err = nil
+		}
+	})
+	return err
+}
+
+func (st *Stream) LocalAddr() net.Addr {
+	return st.session.conn.LocalAddr()
+}
+
+func (st *Stream) RemoteAddr() net.Addr {
+	return st.session.conn.RemoteAddr()
+}
+
+func (st *Stream) SetDeadline(t time.Time) error {
+	return st.SetReadDeadline(t)
+}
+
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.mux.Lock()
+	st.readDeadline = t
+	st.mux.Unlock()
+	signal(st.notify)
+	return nil
+}
+
+// SetWriteDeadline is not supported, writes share the underlying connection
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	return nil
+}
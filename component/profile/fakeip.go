@@ -0,0 +1,137 @@
+package profile
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/ClashrAuto/Clashr/component/fakeip"
+)
+
+type fakeIPPool struct {
+	Range    string           `json:"range"`
+	Bindings []fakeip.Binding `json:"bindings"`
+}
+
+type fakeIPFile struct {
+	Pools []fakeIPPool `json:"pools"`
+}
+
+// FakeIPStore persist the fake ips allocated by the pools to a json file,
+// the changes are written at most once per delay and the file holds at most the size of the pools.
+type FakeIPStore struct {
+	path  string
+	delay time.Duration
+
+	mux   sync.Mutex
+	pools []*fakeip.Pool
+	timer *time.Timer
+}
+
+// Attach restore the bindings in the file to each pool saved with the same range,
+// then persist the changes of the pools. The pools attached before are flushed and detached.
+// The nil pools are ignored, so Attach() only detach the current pools.
+func (s *FakeIPStore) Attach(pools ...*fakeip.Pool) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, pool := range s.pools {
+		pool.OnChange(nil)
+	}
+	s.pools = nil
+
+	saved := map[string][]fakeip.Binding{}
+	if file, err := s.load(); err == nil {
+		for _, pool := range file.Pools {
+			saved[pool.Range] = pool.Bindings
+		}
+	}
+
+	for _, pool := range pools {
+		if pool == nil {
+			continue
+		}
+
+		if bindings, ok := saved[pool.IPNet().String()]; ok {
+			pool.Restore(bindings)
+		}
+		pool.OnChange(func() { s.changed() })
+		s.pools = append(s.pools, pool)
+	}
+	return nil
+}
+
+// Clear drop the fake ips of the attached pools and the file
+func (s *FakeIPStore) Clear() error {
+	s.mux.Lock()
+	pools := s.pools
+	s.mux.Unlock()
+
+	for _, pool := range pools {
+		pool.Clear()
+	}
+	return s.Flush()
+}
+
+// Flush write the pending changes to the file immediately
+func (s *FakeIPStore) Flush() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.timer == nil {
+		return nil
+	}
+	s.timer.Stop()
+	s.timer = nil
+
+	file := &fakeIPFile{Pools: []fakeIPPool{}}
+	for _, pool := range s.pools {
+		file.Pools = append(file.Pools, fakeIPPool{
+			Range:    pool.IPNet().String(),
+			Bindings: pool.Bindings(),
+		})
+	}
+
+	buf, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, buf)
+}
+
+func (s *FakeIPStore) changed() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	// the later changes are batched into the pending write
+	if s.timer != nil {
+		return
+	}
+	s.timer = time.AfterFunc(s.delay, func() { s.Flush() })
+}
+
+func (s *FakeIPStore) load() (*fakeIPFile, error) {
+	buf, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &fakeIPFile{}
+	if err := json.Unmarshal(buf, file); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// NewFakeIPStore return a FakeIPStore writing to path
+func NewFakeIPStore(path string, delay time.Duration) *FakeIPStore {
+	return &FakeIPStore{
+		path:  path,
+		delay: delay,
+	}
+}
@@ -0,0 +1,85 @@
+package profile
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ClashrAuto/Clashr/component/fakeip"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFakeIPPool(cidr string) *fakeip.Pool {
+	_, ipnet, _ := net.ParseCIDR(cidr)
+	pool, _ := fakeip.New(ipnet, 10)
+	return pool
+}
+
+func TestFakeIPStore_Restore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fakeip.json")
+
+	store := NewFakeIPStore(path, 50*time.Millisecond)
+	pool := newFakeIPPool("198.18.0.1/16")
+	pool6 := newFakeIPPool("fdfe:dcba:9876::1/64")
+	assert.Nil(t, store.Attach(pool, pool6))
+	foo := pool.Lookup("foo.com")
+	bar := pool.Lookup("bar.com")
+	foo6 := pool6.Lookup("foo.com")
+
+	time.Sleep(150 * time.Millisecond)
+
+	restored := newFakeIPPool("198.18.0.1/16")
+	restored6 := newFakeIPPool("fdfe:dcba:9876::1/64")
+	assert.Nil(t, NewFakeIPStore(path, time.Hour).Attach(restored, restored6))
+	host, exist := restored.LookBack(foo)
+	assert.True(t, exist)
+	assert.Equal(t, "foo.com", host)
+	assert.True(t, bar.Equal(restored.Lookup("bar.com")))
+	host, exist = restored6.LookBack(foo6)
+	assert.True(t, exist)
+	assert.Equal(t, "foo.com", host)
+
+	// the next allocation doesn't take a restored ip
+	baz := restored.Lookup("baz.com")
+	assert.False(t, baz.Equal(foo))
+	assert.False(t, baz.Equal(bar))
+
+	// the bindings are dropped when the range changes
+	other := newFakeIPPool("198.19.0.1/16")
+	assert.Nil(t, NewFakeIPStore(path, time.Hour).Attach(other))
+	assert.Len(t, other.Bindings(), 0)
+}
+
+func TestFakeIPStore_AttachAndClear(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fakeip.json")
+
+	store := NewFakeIPStore(path, time.Hour)
+	old := newFakeIPPool("198.18.0.1/16")
+	assert.Nil(t, store.Attach(old))
+	foo := old.Lookup("foo.com")
+
+	// reloading the config attach a new pool, which takes over the bindings of the old one
+	pool := newFakeIPPool("198.18.0.1/16")
+	assert.Nil(t, store.Attach(pool))
+	host, exist := pool.LookBack(foo)
+	assert.True(t, exist)
+	assert.Equal(t, "foo.com", host)
+
+	assert.Nil(t, store.Clear())
+	_, exist = pool.LookBack(foo)
+	assert.False(t, exist)
+
+	restored := newFakeIPPool("198.18.0.1/16")
+	assert.Nil(t, NewFakeIPStore(path, time.Hour).Attach(restored))
+	assert.Len(t, restored.Bindings(), 0)
+}
@@ -0,0 +1,100 @@
+package profile
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SelectedStore persist the selected proxy of each select group to a json file,
+// the writes are debounced and replace the file atomically.
+type SelectedStore struct {
+	path  string
+	delay time.Duration
+
+	mux      sync.Mutex
+	selected map[string]string
+	timer    *time.Timer
+}
+
+// Get return the proxy selected in group
+func (s *SelectedStore) Get(group string) (string, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	name, ok := s.selected[group]
+	return name, ok
+}
+
+// Set record the proxy selected in group, the file is written after the delay without other changes
+func (s *SelectedStore) Set(group, name string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.selected[group] == name {
+		return
+	}
+	s.selected[group] = name
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.timer = time.AfterFunc(s.delay, func() { s.Flush() })
+}
+
+// Flush write the pending changes to the file immediately
+func (s *SelectedStore) Flush() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.timer == nil {
+		return nil
+	}
+	s.timer.Stop()
+	s.timer = nil
+
+	buf, err := json.MarshalIndent(s.selected, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, buf)
+}
+
+// writeFileAtomic write to a temporary file in the same directory then rename it,
+// so the file is never left half written
+func writeFileAtomic(path string, buf []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// NewSelectedStore load the selections in path, a missing or broken file is treated as empty
+func NewSelectedStore(path string, delay time.Duration) *SelectedStore {
+	selected := map[string]string{}
+	if buf, err := ioutil.ReadFile(path); err == nil {
+		if err := json.Unmarshal(buf, &selected); err != nil {
+			selected = map[string]string{}
+		}
+	}
+
+	return &SelectedStore{
+		path:     path,
+		delay:    delay,
+		selected: selected,
+	}
+}
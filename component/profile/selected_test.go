@@ -0,0 +1,57 @@
+package profile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectedStore_Debounce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "selected.json")
+
+	store := NewSelectedStore(path, 50*time.Millisecond)
+	store.Set("Proxy", "ss1")
+	store.Set("Proxy", "ss2")
+	store.Set("GLOBAL", "DIRECT")
+
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	time.Sleep(150 * time.Millisecond)
+	reload := NewSelectedStore(path, time.Second)
+	name, ok := reload.Get("Proxy")
+	assert.True(t, ok)
+	assert.Equal(t, "ss2", name)
+	name, _ = reload.Get("GLOBAL")
+	assert.Equal(t, "DIRECT", name)
+
+	// no temporary file is left
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1)
+}
+
+func TestSelectedStore_Flush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "selected.json")
+
+	store := NewSelectedStore(path, time.Hour)
+	store.Set("Proxy", "ss1")
+	assert.Nil(t, store.Flush())
+
+	name, ok := NewSelectedStore(path, time.Hour).Get("Proxy")
+	assert.True(t, ok)
+	assert.Equal(t, "ss1", name)
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte("broken"), 0644))
+	_, ok = NewSelectedStore(path, time.Hour).Get("Proxy")
+	assert.False(t, ok)
+}
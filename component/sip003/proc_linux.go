@@ -0,0 +1,11 @@
+package sip003
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcAttr makes sure the plugin is killed when clash exits
+func setProcAttr(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package sip003
+
+import "os/exec"
+
+func setProcAttr(cmd *exec.Cmd) {}
@@ -0,0 +1,229 @@
+package sip003
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	C "github.com/ClashrAuto/Clashr/constant"
+	"github.com/ClashrAuto/Clashr/log"
+)
+
+const (
+	minRestartDelay = time.Second
+	maxRestartDelay = 30 * time.Second
+
+	// a plugin that ran longer than this is considered healthy, and the restart delay is reset
+	stableDuration = time.Minute
+)
+
+// Option is the configuration of a SIP003 plugin
+type Option struct {
+	Path       string
+	Options    string
+	RemoteHost string
+	RemotePort string
+}
+
+// Plugin is a SIP003 plugin process listening on a local port
+type Plugin struct {
+	path   string
+	env    []string
+	addr   string
+	name   string
+	cmd    *exec.Cmd
+	mux    sync.Mutex
+	done   chan struct{}
+	closed bool
+}
+
+// Addr return the local address the plugin listens on
+func (p *Plugin) Addr() string {
+	return p.addr
+}
+
+// Close stops the supervisor and kills the plugin process
+func (p *Plugin) Close() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+
+	if p.cmd != nil && p.cmd.Process != nil {
+		return p.cmd.Process.Kill()
+	}
+	return nil
+}
+
+func (p *Plugin) start() (*exec.Cmd, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.closed {
+		return nil, errors.New("plugin closed")
+	}
+
+	cmd := exec.Command(p.path)
+	cmd.Env = p.env
+	cmd.Stdout = &logWriter{name: p.name}
+	cmd.Stderr = cmd.Stdout
+	setProcAttr(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p.cmd = cmd
+	return cmd, nil
+}
+
+func (p *Plugin) supervise(cmd *exec.Cmd) {
+	delay := minRestartDelay
+	for {
+		start := time.Now()
+		err := cmd.Wait()
+
+		select {
+		case <-p.done:
+			return
+		default:
+		}
+
+		if time.Since(start) > stableDuration {
+			delay = minRestartDelay
+		}
+		log.Warnln("[SIP003] %s exited: %v", p.name, err)
+
+		for {
+			select {
+			case <-time.After(delay):
+			case <-p.done:
+				return
+			}
+
+			if delay *= 2; delay > maxRestartDelay {
+				delay = maxRestartDelay
+			}
+
+			if cmd, err = p.start(); err == nil {
+				log.Infoln("[SIP003] %s restarted", p.name)
+				break
+			}
+			log.Warnln("[SIP003] %s restart failed: %s", p.name, err.Error())
+		}
+	}
+}
+
+// New starts the plugin and keeps restarting it until Close
+func New(option Option) (*Plugin, error) {
+	path, err := lookPath(option.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Plugin{
+		path: path,
+		addr: net.JoinHostPort("127.0.0.1", port),
+		name: filepath.Base(path),
+		env: append(
+			os.Environ(),
+			"SS_REMOTE_HOST="+option.RemoteHost,
+			"SS_REMOTE_PORT="+option.RemotePort,
+			"SS_LOCAL_HOST=127.0.0.1",
+			"SS_LOCAL_PORT="+port,
+			"SS_PLUGIN_OPTIONS="+option.Options,
+		),
+		done: make(chan struct{}),
+	}
+
+	cmd, err := p.start()
+	if err != nil {
+		return nil, fmt.Errorf("start plugin %s error: %s", path, err.Error())
+	}
+	go p.supervise(cmd)
+
+	return p, nil
+}
+
+// EncodeOptions serialize plugin options to SIP003 format, e.g. `mode=ws;tls;host=bing.com`
+func EncodeOptions(opts map[string]interface{}) string {
+	keys := make([]string, 0, len(opts))
+	for key := range opts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		switch value := opts[key].(type) {
+		case nil:
+			pairs = append(pairs, escape(key))
+		case bool:
+			if value {
+				pairs = append(pairs, escape(key))
+			}
+		default:
+			pairs = append(pairs, escape(key)+"="+escape(fmt.Sprint(value)))
+		}
+	}
+	return strings.Join(pairs, ";")
+}
+
+func escape(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `=`, `\=`, `;`, `\;`)
+	return replacer.Replace(s)
+}
+
+// lookPath finds plugin in PATH first, then in the configuration directory
+func lookPath(name string) (string, error) {
+	if path, err := exec.LookPath(name); err == nil {
+		return path, nil
+	}
+
+	if !filepath.IsAbs(name) {
+		path := filepath.Join(C.Path.HomeDir(), name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("plugin %s not found", name)
+}
+
+func freePort() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	return port, err
+}
+
+type logWriter struct {
+	name string
+}
+
+func (lw *logWriter) Write(b []byte) (int, error) {
+	scanner := bufio.NewScanner(strings.NewReader(string(b)))
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			log.Debugln("[SIP003] %s: %s", lw.name, line)
+		}
+	}
+	return len(b), nil
+}
@@ -0,0 +1,123 @@
+package sip003
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// the test binary runs as a dummy plugin when SIP003_TEST_PLUGIN is set
+func TestMain(m *testing.M) {
+	if os.Getenv("SIP003_TEST_PLUGIN") != "" {
+		runTestPlugin()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// runTestPlugin count its runs in SIP003_TEST_PLUGIN and exit at the first one,
+// the later runs listen on SS_LOCAL_PORT until they are killed
+func runTestPlugin() {
+	path := os.Getenv("SIP003_TEST_PLUGIN")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		os.Exit(2)
+	}
+	f.WriteString("run\n")
+	f.Close()
+
+	if runs, _ := ioutil.ReadFile(path); strings.Count(string(runs), "run") == 1 {
+		os.Exit(1)
+	}
+
+	l, err := net.Listen("tcp", net.JoinHostPort(os.Getenv("SS_LOCAL_HOST"), os.Getenv("SS_LOCAL_PORT")))
+	if err != nil {
+		os.Exit(2)
+	}
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			os.Exit(2)
+		}
+		c.Close()
+	}
+}
+
+func waitFor(timeout time.Duration, f func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if f() {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return false
+}
+
+func canDial(addr string) bool {
+	c, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return false
+	}
+	c.Close()
+	return true
+}
+
+func TestEncodeOptions(t *testing.T) {
+	opts := map[string]interface{}{
+		"mode":   "ws",
+		"tls":    true,
+		"mux":    false,
+		"host":   "bing.com",
+		"path":   "/a;b=c",
+		"nocomp": nil,
+		"mtu":    1350,
+	}
+
+	assert.Equal(t, `host=bing.com;mode=ws;mtu=1350;nocomp;path=/a\;b\=c;tls`, EncodeOptions(opts))
+	assert.Equal(t, "", EncodeOptions(nil))
+}
+
+func TestNew_NotFound(t *testing.T) {
+	_, err := New(Option{Path: "clash-sip003-plugin-not-exist"})
+	assert.Error(t, err)
+}
+
+func TestPlugin_RestartAndClose(t *testing.T) {
+	exe, err := os.Executable()
+	assert.Nil(t, err)
+
+	dir, err := ioutil.TempDir("", "sip003")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	runs := filepath.Join(dir, "runs")
+
+	os.Setenv("SIP003_TEST_PLUGIN", runs)
+	p, err := New(Option{Path: exe, RemoteHost: "127.0.0.1", RemotePort: "8388"})
+	os.Unsetenv("SIP003_TEST_PLUGIN")
+	assert.Nil(t, err)
+	if err != nil {
+		return
+	}
+
+	// the first run exits, the supervisor restarts it after minRestartDelay
+	assert.True(t, waitFor(minRestartDelay+5*time.Second, func() bool { return canDial(p.Addr()) }))
+	buf, err := ioutil.ReadFile(runs)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, strings.Count(string(buf), "run"))
+
+	// Close kills the plugin and it is not restarted again
+	assert.Nil(t, p.Close())
+	assert.True(t, waitFor(5*time.Second, func() bool { return !canDial(p.Addr()) }))
+	time.Sleep(minRestartDelay + 500*time.Millisecond)
+	assert.False(t, canDial(p.Addr()))
+	buf, err = ioutil.ReadFile(runs)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, strings.Count(string(buf), "run"))
+}
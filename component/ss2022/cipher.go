@@ -0,0 +1,142 @@
+package ss2022
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"lukechampine.com/blake3"
+)
+
+const (
+	// HeaderTypeClient and HeaderTypeServer mark the direction of a stream or packet
+	HeaderTypeClient byte = 0
+	HeaderTypeServer byte = 1
+
+	tagSize          = 16
+	maxPayloadSize   = 0xFFFF
+	maxPaddingLength = 900
+	maxTimeDiff      = 30 * time.Second
+
+	sessionSubkeyContext = "shadowsocks 2022 session subkey"
+)
+
+var (
+	ErrBadHeaderType  = errors.New("ss2022: bad header type")
+	ErrBadTimestamp   = errors.New("ss2022: timestamp is out of range")
+	ErrBadRequestSalt = errors.New("ss2022: request salt mismatch")
+	ErrBadSessionID   = errors.New("ss2022: session id mismatch")
+	ErrShortPacket    = errors.New("ss2022: packet too short")
+)
+
+type method struct {
+	keySize int
+	aead    func(key []byte) (cipher.AEAD, error)
+}
+
+var methods = map[string]*method{
+	"2022-blake3-aes-128-gcm":       {keySize: 16, aead: aesGCM},
+	"2022-blake3-aes-256-gcm":       {keySize: 32, aead: aesGCM},
+	"2022-blake3-chacha20-poly1305": {keySize: 32, aead: chacha20poly1305.New},
+}
+
+func aesGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// IsSupported return true if method is one of the Shadowsocks 2022 ciphers
+func IsSupported(method string) bool {
+	_, ok := methods[strings.ToLower(method)]
+	return ok
+}
+
+// Cipher implements the Shadowsocks 2022 edition (SIP022) for a single PSK
+type Cipher struct {
+	psk      []byte
+	keySize  int
+	makeAEAD func(key []byte) (cipher.AEAD, error)
+
+	// block encrypts the separate header of UDP packets,
+	// it is nil for chacha20-poly1305 which uses xchacha20-poly1305 instead.
+	block cipher.Block
+}
+
+// KeySize return the length of PSK, salt and session subkey
+func (c *Cipher) KeySize() int {
+	return c.keySize
+}
+
+func (c *Cipher) sessionKey(salt []byte) []byte {
+	material := make([]byte, len(c.psk)+len(salt))
+	copy(material, c.psk)
+	copy(material[len(c.psk):], salt)
+
+	key := make([]byte, c.keySize)
+	blake3.DeriveKey(key, sessionSubkeyContext, material)
+	return key
+}
+
+func (c *Cipher) sessionAEAD(salt []byte) (cipher.AEAD, error) {
+	return c.makeAEAD(c.sessionKey(salt))
+}
+
+// New return a Cipher with method and base64 encoded PSK
+func New(method, password string) (*Cipher, error) {
+	m, ok := methods[strings.ToLower(method)]
+	if !ok {
+		return nil, fmt.Errorf("ss2022: unsupported method %s", method)
+	}
+
+	psk, err := base64.StdEncoding.DecodeString(password)
+	if err != nil {
+		return nil, fmt.Errorf("ss2022: psk is not valid base64: %s", err.Error())
+	}
+
+	if len(psk) != m.keySize {
+		return nil, fmt.Errorf("ss2022: %s requires a %d bytes psk, got %d", method, m.keySize, len(psk))
+	}
+
+	c := &Cipher{
+		psk:      psk,
+		keySize:  m.keySize,
+		makeAEAD: m.aead,
+	}
+
+	if !strings.Contains(strings.ToLower(method), "chacha20") {
+		if c.block, err = aes.NewCipher(psk); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func checkTimestamp(ts uint64) error {
+	diff := time.Now().Unix() - int64(ts)
+	if diff < 0 {
+		diff = -diff
+	}
+	if time.Duration(diff)*time.Second > maxTimeDiff {
+		return ErrBadTimestamp
+	}
+	return nil
+}
+
+// increment treats b as a little-endian counter
+func increment(b []byte) {
+	for i := range b {
+		b[i]++
+		if b[i] != 0 {
+			return
+		}
+	}
+}
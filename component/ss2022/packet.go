@@ -0,0 +1,193 @@
+package ss2022
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// PacketConn wraps pc as a SIP022 client packet connection.
+// Payloads given to WriteTo and returned by ReadFrom are SOCKS address followed by data.
+func (c *Cipher) PacketConn(pc net.PacketConn) net.PacketConn {
+	var id [8]byte
+	rand.Read(id[:])
+	return &packetConn{
+		PacketConn: pc,
+		cipher:     c,
+		sessionID:  binary.BigEndian.Uint64(id[:]),
+	}
+}
+
+type packetConn struct {
+	net.PacketConn
+	cipher    *Cipher
+	sessionID uint64
+
+	mux        sync.Mutex
+	packetID   uint64
+	aead       cipher.AEAD
+	remoteID   uint64
+	remoteAEAD cipher.AEAD
+}
+
+func (pc *packetConn) nextPacketID() uint64 {
+	pc.mux.Lock()
+	defer pc.mux.Unlock()
+	pc.packetID++
+	return pc.packetID
+}
+
+func (pc *packetConn) sessionAEAD() (cipher.AEAD, error) {
+	pc.mux.Lock()
+	defer pc.mux.Unlock()
+	if pc.aead == nil {
+		var id [8]byte
+		binary.BigEndian.PutUint64(id[:], pc.sessionID)
+		aead, err := pc.cipher.sessionAEAD(id[:])
+		if err != nil {
+			return nil, err
+		}
+		pc.aead = aead
+	}
+	return pc.aead, nil
+}
+
+func (pc *packetConn) remoteSessionAEAD(id []byte) (cipher.AEAD, error) {
+	pc.mux.Lock()
+	defer pc.mux.Unlock()
+	remoteID := binary.BigEndian.Uint64(id)
+	if pc.remoteAEAD == nil || pc.remoteID != remoteID {
+		aead, err := pc.cipher.sessionAEAD(id)
+		if err != nil {
+			return nil, err
+		}
+		pc.remoteID = remoteID
+		pc.remoteAEAD = aead
+	}
+	return pc.remoteAEAD, nil
+}
+
+func (pc *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	// main header: type + timestamp + padding length (without padding)
+	var header [1 + 8 + 2]byte
+	header[0] = HeaderTypeClient
+	binary.BigEndian.PutUint64(header[1:], uint64(time.Now().Unix()))
+
+	var packet []byte
+	if pc.cipher.block == nil {
+		aead, err := chacha20poly1305.NewX(pc.cipher.psk)
+		if err != nil {
+			return 0, err
+		}
+
+		plain := make([]byte, 0, 16+len(header)+len(b))
+		plain = appendUint64(plain, pc.sessionID)
+		plain = appendUint64(plain, pc.nextPacketID())
+		plain = append(plain, header[:]...)
+		plain = append(plain, b...)
+
+		packet = make([]byte, chacha20poly1305.NonceSizeX, chacha20poly1305.NonceSizeX+len(plain)+tagSize)
+		if _, err := rand.Read(packet); err != nil {
+			return 0, err
+		}
+		packet = aead.Seal(packet, packet, plain, nil)
+	} else {
+		aead, err := pc.sessionAEAD()
+		if err != nil {
+			return 0, err
+		}
+
+		plain := make([]byte, 0, len(header)+len(b))
+		plain = append(plain, header[:]...)
+		plain = append(plain, b...)
+
+		packet = make([]byte, 16, 16+len(plain)+tagSize)
+		binary.BigEndian.PutUint64(packet[:8], pc.sessionID)
+		binary.BigEndian.PutUint64(packet[8:16], pc.nextPacketID())
+		packet = aead.Seal(packet, packet[4:16], plain, nil)
+		pc.cipher.block.Encrypt(packet[:16], packet[:16])
+	}
+
+	if _, err := pc.PacketConn.WriteTo(packet, addr); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (pc *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := pc.PacketConn.ReadFrom(b)
+	if err != nil {
+		return n, addr, err
+	}
+
+	var plain []byte
+	if pc.cipher.block == nil {
+		if n < chacha20poly1305.NonceSizeX+16+tagSize {
+			return 0, addr, ErrShortPacket
+		}
+
+		aead, err := chacha20poly1305.NewX(pc.cipher.psk)
+		if err != nil {
+			return 0, addr, err
+		}
+
+		nonce := b[:chacha20poly1305.NonceSizeX]
+		plain, err = aead.Open(b[len(nonce):len(nonce)], nonce, b[len(nonce):n], nil)
+		if err != nil {
+			return 0, addr, err
+		}
+
+		// skip session id and packet id of server
+		plain = plain[16:]
+	} else {
+		if n < 16+tagSize {
+			return 0, addr, ErrShortPacket
+		}
+
+		pc.cipher.block.Decrypt(b[:16], b[:16])
+		aead, err := pc.remoteSessionAEAD(b[:8])
+		if err != nil {
+			return 0, addr, err
+		}
+
+		plain, err = aead.Open(b[16:16], b[4:16], b[16:n], nil)
+		if err != nil {
+			return 0, addr, err
+		}
+	}
+
+	// type + timestamp + client session id + padding length
+	if len(plain) < 1+8+8+2 {
+		return 0, addr, ErrShortPacket
+	}
+
+	if plain[0] != HeaderTypeServer {
+		return 0, addr, ErrBadHeaderType
+	}
+
+	if err := checkTimestamp(binary.BigEndian.Uint64(plain[1:9])); err != nil {
+		return 0, addr, err
+	}
+
+	if binary.BigEndian.Uint64(plain[9:17]) != pc.sessionID {
+		return 0, addr, ErrBadSessionID
+	}
+
+	paddingLen := int(binary.BigEndian.Uint16(plain[17:19]))
+	if len(plain) < 19+paddingLen {
+		return 0, addr, ErrShortPacket
+	}
+
+	return copy(b, plain[19+paddingLen:]), addr, nil
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
@@ -0,0 +1,244 @@
+package ss2022
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ClashrAuto/Clashr/component/socks5"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+var testMethods = []string{
+	"2022-blake3-aes-128-gcm",
+	"2022-blake3-aes-256-gcm",
+	"2022-blake3-chacha20-poly1305",
+}
+
+func newTestCipher(t *testing.T, method string) *Cipher {
+	psk := make([]byte, methods[method].keySize)
+	rand.Read(psk)
+	c, err := New(method, base64.StdEncoding.EncodeToString(psk))
+	assert.Nil(t, err)
+	return c
+}
+
+// serveStream is a minimal SIP022 server, it echoes everything received
+func serveStream(c *Cipher, conn net.Conn, timestamp int64) error {
+	defer conn.Close()
+
+	salt := make([]byte, c.keySize)
+	if _, err := io.ReadFull(conn, salt); err != nil {
+		return err
+	}
+	reader, err := c.sessionAEAD(salt)
+	if err != nil {
+		return err
+	}
+	server := &streamConn{Conn: conn, cipher: c, reader: reader, rNonce: make([]byte, reader.NonceSize())}
+
+	fixed, err := server.readSealed(1 + 8 + 2)
+	if err != nil {
+		return err
+	}
+	if fixed[0] != HeaderTypeClient {
+		return ErrBadHeaderType
+	}
+	if err := checkTimestamp(binary.BigEndian.Uint64(fixed[1:9])); err != nil {
+		return err
+	}
+
+	variable, err := server.readSealed(int(binary.BigEndian.Uint16(fixed[9:])))
+	if err != nil {
+		return err
+	}
+	addr := socks5.SplitAddr(variable)
+	paddingLen := int(binary.BigEndian.Uint16(variable[len(addr):]))
+	payload := append([]byte{}, variable[len(addr)+2+paddingLen:]...)
+
+	respSalt := make([]byte, c.keySize)
+	rand.Read(respSalt)
+	writer, err := c.sessionAEAD(respSalt)
+	if err != nil {
+		return err
+	}
+	server.writer = writer
+	server.wNonce = make([]byte, writer.NonceSize())
+
+	header := []byte{HeaderTypeServer}
+	header = appendUint64(header, uint64(timestamp))
+	header = append(header, salt...)
+	header = append(header, byte(len(payload)>>8), byte(len(payload)))
+
+	buf := append([]byte{}, respSalt...)
+	buf = writer.Seal(buf, server.wNonce, header, nil)
+	increment(server.wNonce)
+	buf = writer.Seal(buf, server.wNonce, payload, nil)
+	increment(server.wNonce)
+	if _, err := conn.Write(buf); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(server, server)
+	return err
+}
+
+// servePacket is a minimal SIP022 udp server, it echoes every packet
+func servePacket(c *Cipher, pc net.PacketConn) {
+	var serverID [8]byte
+	rand.Read(serverID[:])
+	buf := make([]byte, 65535)
+
+	for packetID := uint64(1); ; packetID++ {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		var clientID, plain []byte
+		if c.block == nil {
+			aead, _ := chacha20poly1305.NewX(c.psk)
+			plain, err = aead.Open(nil, buf[:24], buf[24:n], nil)
+			if err != nil {
+				continue
+			}
+			clientID, plain = plain[:8], plain[16:]
+		} else {
+			c.block.Decrypt(buf[:16], buf[:16])
+			aead, _ := c.sessionAEAD(buf[:8])
+			clientID = append([]byte{}, buf[:8]...)
+			plain, err = aead.Open(nil, buf[4:16], buf[16:n], nil)
+			if err != nil {
+				continue
+			}
+		}
+
+		if plain[0] != HeaderTypeClient || checkTimestamp(binary.BigEndian.Uint64(plain[1:9])) != nil {
+			continue
+		}
+		paddingLen := int(binary.BigEndian.Uint16(plain[9:11]))
+		payload := plain[11+paddingLen:]
+
+		body := []byte{HeaderTypeServer}
+		body = appendUint64(body, uint64(time.Now().Unix()))
+		body = append(body, clientID...)
+		body = append(body, 0, 0)
+		body = append(body, payload...)
+
+		var packet []byte
+		if c.block == nil {
+			aead, _ := chacha20poly1305.NewX(c.psk)
+			nonce := make([]byte, 24)
+			rand.Read(nonce)
+			plain := append(append([]byte{}, serverID[:]...), appendUint64(nil, packetID)...)
+			packet = aead.Seal(nonce, nonce, append(plain, body...), nil)
+		} else {
+			aead, _ := c.sessionAEAD(serverID[:])
+			header := append(append([]byte{}, serverID[:]...), appendUint64(nil, packetID)...)
+			packet = aead.Seal(header, header[4:16], body, nil)
+			c.block.Encrypt(packet[:16], packet[:16])
+		}
+		pc.WriteTo(packet, addr)
+	}
+}
+
+func TestNew_Error(t *testing.T) {
+	_, err := New("2022-blake3-aes-128-gcm", "not base64!")
+	assert.Error(t, err)
+
+	_, err = New("2022-blake3-aes-256-gcm", base64.StdEncoding.EncodeToString(make([]byte, 16)))
+	assert.Error(t, err)
+
+	_, err = New("aes-128-gcm", base64.StdEncoding.EncodeToString(make([]byte, 16)))
+	assert.Error(t, err)
+
+	assert.True(t, IsSupported("2022-BLAKE3-AES-128-GCM"))
+	assert.False(t, IsSupported("chacha20-ietf-poly1305"))
+}
+
+func TestStreamConn_Echo(t *testing.T) {
+	for _, method := range testMethods {
+		c := newTestCipher(t, method)
+		client, server := net.Pipe()
+		go serveStream(c, server, time.Now().Unix())
+
+		conn := c.StreamConn(client)
+		_, err := conn.Write(socks5.ParseAddr("example.com:443"))
+		assert.Nil(t, err, method)
+		go func() {
+			conn.Write([]byte("hello"))
+			// larger than one chunk
+			conn.Write(bytes.Repeat([]byte{'a'}, maxPayloadSize+1))
+		}()
+
+		buf := make([]byte, 5+maxPayloadSize+1)
+		_, err = io.ReadFull(conn, buf)
+		assert.Nil(t, err, method)
+		assert.Equal(t, []byte("hello"), buf[:5], method)
+		assert.Equal(t, bytes.Repeat([]byte{'a'}, maxPayloadSize+1), buf[5:], method)
+		conn.Close()
+	}
+}
+
+func TestStreamConn_InitialPayload(t *testing.T) {
+	c := newTestCipher(t, "2022-blake3-aes-128-gcm")
+	client, server := net.Pipe()
+	go serveStream(c, server, time.Now().Unix())
+
+	conn := c.StreamConn(client)
+	_, err := conn.Write(append([]byte(socks5.ParseAddr("1.1.1.1:53")), []byte("payload")...))
+	assert.Nil(t, err)
+
+	buf := make([]byte, 7)
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("payload"), buf)
+	conn.Close()
+}
+
+func TestStreamConn_BadTimestamp(t *testing.T) {
+	c := newTestCipher(t, "2022-blake3-aes-256-gcm")
+	client, server := net.Pipe()
+	go serveStream(c, server, time.Now().Add(-time.Minute).Unix())
+
+	conn := c.StreamConn(client)
+	_, err := conn.Write(socks5.ParseAddr("example.com:80"))
+	assert.Nil(t, err)
+
+	_, err = conn.Read(make([]byte, 1))
+	assert.Equal(t, ErrBadTimestamp, err)
+	conn.Close()
+}
+
+func TestPacketConn_Echo(t *testing.T) {
+	for _, method := range testMethods {
+		c := newTestCipher(t, method)
+		server, err := net.ListenPacket("udp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		go servePacket(c, server)
+
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		client := c.PacketConn(pc)
+
+		payload := append([]byte(socks5.ParseAddr("8.8.8.8:53")), []byte("query")...)
+		_, err = client.WriteTo(payload, server.LocalAddr())
+		assert.Nil(t, err, method)
+
+		client.SetReadDeadline(time.Now().Add(time.Second))
+		buf := make([]byte, 1024)
+		n, _, err := client.ReadFrom(buf)
+		assert.Nil(t, err, method)
+		assert.Equal(t, payload, buf[:n], method)
+
+		client.Close()
+		server.Close()
+	}
+}
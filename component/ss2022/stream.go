@@ -0,0 +1,230 @@
+package ss2022
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	mrand "math/rand"
+	"net"
+	"time"
+
+	"github.com/ClashrAuto/Clashr/component/socks5"
+)
+
+// StreamConn wraps conn as a SIP022 client stream.
+// The first Write must start with a SOCKS address, the rest of it is sent as initial payload.
+func (c *Cipher) StreamConn(conn net.Conn) net.Conn {
+	return &streamConn{Conn: conn, cipher: c}
+}
+
+type streamConn struct {
+	net.Conn
+	cipher *Cipher
+
+	// request salt, be checked with the response header
+	salt []byte
+
+	writer cipher.AEAD
+	wNonce []byte
+	wBuf   []byte
+
+	reader cipher.AEAD
+	rNonce []byte
+	rBuf   []byte
+	remain []byte
+}
+
+func (sc *streamConn) Write(b []byte) (int, error) {
+	if sc.writer == nil {
+		return sc.writeRequest(b)
+	}
+
+	if err := sc.writeChunks(b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (sc *streamConn) writeRequest(b []byte) (int, error) {
+	addr := socks5.SplitAddr(b)
+	if addr == nil {
+		return 0, errors.New("ss2022: first write must begin with a socks address")
+	}
+
+	salt := make([]byte, sc.cipher.keySize)
+	if _, err := rand.Read(salt); err != nil {
+		return 0, err
+	}
+
+	aead, err := sc.cipher.sessionAEAD(salt)
+	if err != nil {
+		return 0, err
+	}
+
+	payload := b[len(addr):]
+	paddingLen := 0
+	if len(payload) == 0 {
+		paddingLen = mrand.Intn(maxPaddingLength) + 1
+	}
+
+	var remain []byte
+	if max := maxPayloadSize - len(addr) - 2 - paddingLen; len(payload) > max {
+		payload, remain = payload[:max], payload[max:]
+	}
+
+	variable := &bytes.Buffer{}
+	variable.Write(addr)
+	binary.Write(variable, binary.BigEndian, uint16(paddingLen))
+	variable.Write(make([]byte, paddingLen))
+	variable.Write(payload)
+
+	fixed := make([]byte, 1+8+2)
+	fixed[0] = HeaderTypeClient
+	binary.BigEndian.PutUint64(fixed[1:], uint64(time.Now().Unix()))
+	binary.BigEndian.PutUint16(fixed[9:], uint16(variable.Len()))
+
+	nonce := make([]byte, aead.NonceSize())
+	buf := make([]byte, 0, len(salt)+len(fixed)+variable.Len()+2*tagSize)
+	buf = append(buf, salt...)
+	buf = aead.Seal(buf, nonce, fixed, nil)
+	increment(nonce)
+	buf = aead.Seal(buf, nonce, variable.Bytes(), nil)
+	increment(nonce)
+
+	if _, err := sc.Conn.Write(buf); err != nil {
+		return 0, err
+	}
+
+	sc.salt = salt
+	sc.writer = aead
+	sc.wNonce = nonce
+
+	if len(remain) != 0 {
+		if err := sc.writeChunks(remain); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (sc *streamConn) writeChunks(b []byte) error {
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > maxPayloadSize {
+			chunk = chunk[:maxPayloadSize]
+		}
+		b = b[len(chunk):]
+
+		size := 2 + tagSize + len(chunk) + tagSize
+		if cap(sc.wBuf) < size {
+			sc.wBuf = make([]byte, size)
+		}
+		buf := sc.wBuf[:size]
+
+		binary.BigEndian.PutUint16(buf, uint16(len(chunk)))
+		sc.writer.Seal(buf[:0], sc.wNonce, buf[:2], nil)
+		increment(sc.wNonce)
+		sc.writer.Seal(buf[2+tagSize:2+tagSize], sc.wNonce, chunk, nil)
+		increment(sc.wNonce)
+
+		if _, err := sc.Conn.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sc *streamConn) Read(b []byte) (int, error) {
+	if sc.reader == nil {
+		if err := sc.readResponse(); err != nil {
+			return 0, err
+		}
+	}
+
+	for len(sc.remain) == 0 {
+		payload, err := sc.readChunk()
+		if err != nil {
+			return 0, err
+		}
+		sc.remain = payload
+	}
+
+	n := copy(b, sc.remain)
+	sc.remain = sc.remain[n:]
+	return n, nil
+}
+
+func (sc *streamConn) readResponse() error {
+	if sc.salt == nil {
+		return errors.New("ss2022: read before request sent")
+	}
+
+	keySize := sc.cipher.keySize
+	buf := make([]byte, keySize+1+8+keySize+2+tagSize)
+	if _, err := io.ReadFull(sc.Conn, buf); err != nil {
+		return err
+	}
+
+	aead, err := sc.cipher.sessionAEAD(buf[:keySize])
+	if err != nil {
+		return err
+	}
+	sc.reader = aead
+	sc.rNonce = make([]byte, aead.NonceSize())
+
+	fixed, err := aead.Open(buf[keySize:keySize], sc.rNonce, buf[keySize:], nil)
+	if err != nil {
+		return err
+	}
+	increment(sc.rNonce)
+
+	if fixed[0] != HeaderTypeServer {
+		return ErrBadHeaderType
+	}
+
+	if err := checkTimestamp(binary.BigEndian.Uint64(fixed[1:9])); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(fixed[9:9+keySize], sc.salt) {
+		return ErrBadRequestSalt
+	}
+
+	length := int(binary.BigEndian.Uint16(fixed[9+keySize:]))
+	payload, err := sc.readSealed(length)
+	if err != nil {
+		return err
+	}
+	sc.remain = payload
+	return nil
+}
+
+func (sc *streamConn) readChunk() ([]byte, error) {
+	lenBuf, err := sc.readSealed(2)
+	if err != nil {
+		return nil, err
+	}
+	return sc.readSealed(int(binary.BigEndian.Uint16(lenBuf)))
+}
+
+func (sc *streamConn) readSealed(length int) ([]byte, error) {
+	size := length + tagSize
+	if cap(sc.rBuf) < size {
+		sc.rBuf = make([]byte, size)
+	}
+	buf := sc.rBuf[:size]
+
+	if _, err := io.ReadFull(sc.Conn, buf); err != nil {
+		return nil, err
+	}
+
+	plain, err := sc.reader.Open(buf[:0], sc.rNonce, buf, nil)
+	if err != nil {
+		return nil, err
+	}
+	increment(sc.rNonce)
+	return plain, nil
+}
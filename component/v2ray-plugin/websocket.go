@@ -14,7 +14,6 @@ type Option struct {
 	Path      string
 	Headers   map[string]string
 	TLSConfig *tls.Config
-	Mux       bool
 }
 
 // NewV2rayObfs return a HTTPObfs
@@ -32,18 +31,5 @@ func NewV2rayObfs(conn net.Conn, option *Option) (net.Conn, error) {
 		TLSConfig: option.TLSConfig,
 	}
 
-	var err error
-	conn, err = vmess.NewWebsocketConn(conn, config)
-	if err != nil {
-		return nil, err
-	}
-
-	if option.Mux {
-		conn = NewMux(conn, MuxOption{
-			ID:   [2]byte{0, 0},
-			Host: "127.0.0.1",
-			Port: 0,
-		})
-	}
-	return conn, nil
+	return vmess.NewWebsocketConn(conn, config)
 }
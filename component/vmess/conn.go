@@ -77,16 +77,21 @@ func (vc *Conn) sendRequest() error {
 	// P Sec Reserve Cmd
 	buf.WriteByte(byte(p<<4) | byte(vc.security))
 	buf.WriteByte(0)
-	if vc.dst.UDP {
+	switch {
+	case vc.dst.Mux:
+		buf.WriteByte(CommandMux)
+	case vc.dst.UDP:
 		buf.WriteByte(CommandUDP)
-	} else {
+	default:
 		buf.WriteByte(CommandTCP)
 	}
 
 	// Port AddrType Addr
-	binary.Write(buf, binary.BigEndian, uint16(vc.dst.Port))
-	buf.WriteByte(vc.dst.AddrType)
-	buf.Write(vc.dst.Addr)
+	if !vc.dst.Mux {
+		binary.Write(buf, binary.BigEndian, uint16(vc.dst.Port))
+		buf.WriteByte(vc.dst.AddrType)
+		buf.Write(vc.dst.Addr)
+	}
 
 	// padding
 	if p > 0 {
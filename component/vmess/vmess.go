@@ -47,6 +47,7 @@ var (
 const (
 	CommandTCP byte = 1
 	CommandUDP byte = 2
+	CommandMux byte = 3
 )
 
 // Addr types
@@ -58,7 +59,9 @@ const (
 
 // DstAddr store destination address
 type DstAddr struct {
-	UDP      bool
+	UDP bool
+	// Mux requests a Mux.Cool connection, the address is omitted
+	Mux      bool
 	AddrType byte
 	Addr     []byte
 	Port     uint
@@ -88,6 +91,8 @@ type Config struct {
 	WebSocketHeaders map[string]string
 	SkipCertVerify   bool
 	SessionCache     tls.ClientSessionCache
+	// TLSConfig replaces the tls config built from SkipCertVerify and SessionCache
+	TLSConfig *tls.Config
 }
 
 // New return a Conn with net.Conn and DstAddr
@@ -141,7 +146,9 @@ func NewClient(config Config) (*Client, error) {
 	host := net.JoinHostPort(config.HostName, config.Port)
 
 	var tlsConfig *tls.Config
-	if config.TLS {
+	if config.TLS && config.TLSConfig != nil {
+		tlsConfig = config.TLSConfig
+	} else if config.TLS {
 		tlsConfig = &tls.Config{
 			ServerName:         config.HostName,
 			InsecureSkipVerify: config.SkipCertVerify,
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -8,10 +9,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	adapters "github.com/ClashrAuto/Clashr/adapters/outbound"
 	"github.com/ClashrAuto/Clashr/common/structure"
 	"github.com/ClashrAuto/Clashr/component/auth"
+	"github.com/ClashrAuto/Clashr/component/dialer"
 	trie "github.com/ClashrAuto/Clashr/component/domain-trie"
 	"github.com/ClashrAuto/Clashr/component/fakeip"
 	C "github.com/ClashrAuto/Clashr/constant"
@@ -25,35 +28,52 @@ import (
 
 // General config
 type General struct {
-	Port               int          `json:"port"`
-	SocksPort          int          `json:"socks-port"`
-	RedirPort          int          `json:"redir-port"`
-	Authentication     []string     `json:"authentication"`
-	AllowLan           bool         `json:"allow-lan"`
-	BindAddress        string       `json:"bind-address"`
-	Mode               T.Mode       `json:"mode"`
-	LogLevel           log.LogLevel `json:"log-level"`
-	ExternalController string       `json:"-"`
-	ExternalUI         string       `json:"-"`
-	Secret             string       `json:"-"`
+	Port               int              `json:"port"`
+	SocksPort          int              `json:"socks-port"`
+	RedirPort          int              `json:"redir-port"`
+	Authentication     []string         `json:"authentication"`
+	AllowLan           bool             `json:"allow-lan"`
+	BindAddress        string           `json:"bind-address"`
+	Mode               T.Mode           `json:"mode"`
+	LogLevel           log.LogLevel     `json:"log-level"`
+	Interface          string           `json:"interface-name"`
+	RoutingMark        int              `json:"routing-mark"`
+	SourceIP           net.IP           `json:"source-ip"`
+	IPVersion          dialer.IPVersion `json:"ip-version"`
+	ExternalController string           `json:"-"`
+	ExternalUI         string           `json:"-"`
+	Secret             string           `json:"-"`
 }
 
 // DNS config
 type DNS struct {
-	Enable         bool             `yaml:"enable"`
-	IPv6           bool             `yaml:"ipv6"`
-	NameServer     []dns.NameServer `yaml:"nameserver"`
-	Fallback       []dns.NameServer `yaml:"fallback"`
-	FallbackFilter FallbackFilter   `yaml:"fallback-filter"`
-	Listen         string           `yaml:"listen"`
-	EnhancedMode   dns.EnhancedMode `yaml:"enhanced-mode"`
-	FakeIPRange    *fakeip.Pool
+	Enable            bool                        `yaml:"enable"`
+	IPv6              bool                        `yaml:"ipv6"`
+	NameServer        []dns.NameServer            `yaml:"nameserver"`
+	DefaultNameServer []dns.NameServer            `yaml:"default-nameserver"`
+	Fallback          []dns.NameServer            `yaml:"fallback"`
+	FallbackFilter    FallbackFilter              `yaml:"fallback-filter"`
+	Cache             dns.CacheConfig             `yaml:"cache"`
+	NameServerPolicy  map[string][]dns.NameServer `yaml:"nameserver-policy"`
+	Listen            string                      `yaml:"listen"`
+	TLSListen         string                      `yaml:"tls-listen"`
+	HTTPSListen       string                      `yaml:"https-listen"`
+	Certificate       *tls.Certificate            `yaml:"-"`
+	EnhancedMode      dns.EnhancedMode            `yaml:"enhanced-mode"`
+	FakeIPRange       *fakeip.Pool
+	FakeIPRange6      *fakeip.Pool
+	FakeIPFilter      *trie.Trie
+	Blocker           *dns.Blocker
+	// ProxyServers is the server hostnames of the proxies used by the nameservers
+	ProxyServers []string
 }
 
 // FallbackFilter config
 type FallbackFilter struct {
-	GeoIP  bool         `yaml:"geoip"`
-	IPCIDR []*net.IPNet `yaml:"ipcidr"`
+	GeoIP        bool         `yaml:"geoip"`
+	IPCIDR       []*net.IPNet `yaml:"ipcidr"`
+	IPCIDRInvert bool         `yaml:"ipcidr-invert"`
+	Domain       []string     `yaml:"domain"`
 }
 
 // Experimental config
@@ -73,33 +93,88 @@ type Config struct {
 }
 
 type rawDNS struct {
-	Enable         bool              `yaml:"enable"`
-	IPv6           bool              `yaml:"ipv6"`
-	NameServer     []string          `yaml:"nameserver"`
-	Fallback       []string          `yaml:"fallback"`
-	FallbackFilter rawFallbackFilter `yaml:"fallback-filter"`
-	Listen         string            `yaml:"listen"`
-	EnhancedMode   dns.EnhancedMode  `yaml:"enhanced-mode"`
-	FakeIPRange    string            `yaml:"fake-ip-range"`
+	Enable            bool                      `yaml:"enable"`
+	IPv6              bool                      `yaml:"ipv6"`
+	NameServer        []string                  `yaml:"nameserver"`
+	DefaultNameServer []string                  `yaml:"default-nameserver"`
+	Fallback          []string                  `yaml:"fallback"`
+	FallbackFilter    rawFallbackFilter         `yaml:"fallback-filter"`
+	Cache             rawDNSCache               `yaml:"cache"`
+	NameServerPolicy  map[string]nameServerList `yaml:"nameserver-policy"`
+	Listen            string                    `yaml:"listen"`
+	TLSListen         string                    `yaml:"tls-listen"`
+	HTTPSListen       string                    `yaml:"https-listen"`
+	Certificate       string                    `yaml:"certificate"`
+	PrivateKey        string                    `yaml:"private-key"`
+	EnhancedMode      dns.EnhancedMode          `yaml:"enhanced-mode"`
+	FakeIPRange       string                    `yaml:"fake-ip-range"`
+	FakeIPRange6      string                    `yaml:"fake-ip-range6"`
+	FakeIPFilter      []string                  `yaml:"fake-ip-filter"`
+	FakeIPFilterFile  string                    `yaml:"fake-ip-filter-file"`
+	Blocklist         rawBlocklist              `yaml:"blocklist"`
+}
+
+// nameServerList is a nameserver or a list of nameservers in yaml
+type nameServerList []string
+
+func (l *nameServerList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var server string
+	if err := unmarshal(&server); err == nil {
+		*l = nameServerList{server}
+		return nil
+	}
+
+	var servers []string
+	if err := unmarshal(&servers); err != nil {
+		return err
+	}
+	*l = servers
+	return nil
 }
 
 type rawFallbackFilter struct {
-	GeoIP  bool     `yaml:"geoip"`
-	IPCIDR []string `yaml:"ipcidr"`
+	GeoIP        bool     `yaml:"geoip"`
+	IPCIDR       []string `yaml:"ipcidr"`
+	IPCIDRInvert bool     `yaml:"ipcidr-invert"`
+	Domain       []string `yaml:"domain"`
+}
+
+// rawDNSCache is the cache of dns, the ttls are in seconds
+type rawDNSCache struct {
+	Size       int  `yaml:"size"`
+	MinTTL     int  `yaml:"min-ttl"`
+	MaxTTL     int  `yaml:"max-ttl"`
+	ServeStale bool `yaml:"serve-stale"`
+	MaxStale   int  `yaml:"max-stale"`
+	Prefetch   bool `yaml:"prefetch"`
+}
+
+// rawBlocklist is the block lists of the dns server, the paths are relative to the home dir
+type rawBlocklist struct {
+	Response string `yaml:"response"`
+	Lists    []struct {
+		Name string `yaml:"name"`
+		Path string `yaml:"path"`
+	} `yaml:"lists"`
 }
 
 type rawConfig struct {
-	Port               int          `yaml:"port"`
-	SocksPort          int          `yaml:"socks-port"`
-	RedirPort          int          `yaml:"redir-port"`
-	Authentication     []string     `yaml:"authentication"`
-	AllowLan           bool         `yaml:"allow-lan"`
-	BindAddress        string       `yaml:"bind-address"`
-	Mode               T.Mode       `yaml:"mode"`
-	LogLevel           log.LogLevel `yaml:"log-level"`
-	ExternalController string       `yaml:"external-controller"`
-	ExternalUI         string       `yaml:"external-ui"`
-	Secret             string       `yaml:"secret"`
+	Port               int              `yaml:"port"`
+	SocksPort          int              `yaml:"socks-port"`
+	RedirPort          int              `yaml:"redir-port"`
+	Authentication     []string         `yaml:"authentication"`
+	AllowLan           bool             `yaml:"allow-lan"`
+	BindAddress        string           `yaml:"bind-address"`
+	Mode               T.Mode           `yaml:"mode"`
+	LogLevel           log.LogLevel     `yaml:"log-level"`
+	Interface          string           `yaml:"interface-name"`
+	RoutingMark        int              `yaml:"routing-mark"`
+	SourceIP           string           `yaml:"source-ip"`
+	IPVersion          dialer.IPVersion `yaml:"ip-version"`
+	RejectPage         string           `yaml:"reject-page"`
+	ExternalController string           `yaml:"external-controller"`
+	ExternalUI         string           `yaml:"external-ui"`
+	Secret             string           `yaml:"secret"`
 
 	Hosts        map[string]string        `yaml:"hosts"`
 	DNS          rawDNS                   `yaml:"dns"`
@@ -161,6 +236,11 @@ func readConfig(path string) (*rawConfig, error) {
 			FallbackFilter: rawFallbackFilter{
 				GeoIP:  true,
 				IPCIDR: []string{},
+				Domain: []string{},
+			},
+			Cache: rawDNSCache{
+				Size:     4096,
+				MaxStale: 86400,
 			},
 		},
 	}
@@ -192,18 +272,21 @@ func Parse(path string) (*Config, error) {
 
 	rules, err := parseRules(rawCfg, proxies)
 	if err != nil {
+		destroyProxies(proxies)
 		return nil, err
 	}
 	config.Rules = rules
 
-	dnsCfg, err := parseDNS(rawCfg.DNS)
+	dnsCfg, err := parseDNS(rawCfg, proxies)
 	if err != nil {
+		destroyProxies(proxies)
 		return nil, err
 	}
 	config.DNS = dnsCfg
 
 	hosts, err := parseHosts(rawCfg)
 	if err != nil {
+		destroyProxies(proxies)
 		return nil, err
 	}
 	config.Hosts = hosts
@@ -225,6 +308,13 @@ func parseGeneral(cfg *rawConfig) (*General, error) {
 	mode := cfg.Mode
 	logLevel := cfg.LogLevel
 
+	var sourceIP net.IP
+	if cfg.SourceIP != "" {
+		if sourceIP = net.ParseIP(cfg.SourceIP); sourceIP == nil {
+			return nil, fmt.Errorf("source-ip: %s is not a valid ip", cfg.SourceIP)
+		}
+	}
+
 	if externalUI != "" {
 		if !filepath.IsAbs(externalUI) {
 			externalUI = filepath.Join(C.Path.HomeDir(), externalUI)
@@ -243,6 +333,10 @@ func parseGeneral(cfg *rawConfig) (*General, error) {
 		BindAddress:        bindAddress,
 		Mode:               mode,
 		LogLevel:           logLevel,
+		Interface:          cfg.Interface,
+		RoutingMark:        cfg.RoutingMark,
+		SourceIP:           sourceIP,
+		IPVersion:          cfg.IPVersion,
 		ExternalController: externalController,
 		ExternalUI:         externalUI,
 		Secret:             secret,
@@ -250,8 +344,32 @@ func parseGeneral(cfg *rawConfig) (*General, error) {
 	return general, nil
 }
 
-func parseProxies(cfg *rawConfig) (map[string]C.Proxy, error) {
+// parseRejectPage read the html served by REJECT-PAGE, the path is relative to the home dir
+func parseRejectPage(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(C.Path.HomeDir(), path)
+	}
+
+	page, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reject-page: %s", err.Error())
+	}
+	return page, nil
+}
+
+func parseProxies(cfg *rawConfig) (_ map[string]C.Proxy, err error) {
 	proxies := make(map[string]C.Proxy)
+	// release the resources (e.g. plugin processes) of parsed proxies when failed
+	defer func() {
+		if err != nil {
+			destroyProxies(proxies)
+		}
+	}()
+
 	proxyList := []string{}
 	proxiesConfig := cfg.Proxy
 	groupsConfig := cfg.ProxyGroup
@@ -259,8 +377,15 @@ func parseProxies(cfg *rawConfig) (map[string]C.Proxy, error) {
 	decoder := structure.NewDecoder(structure.Option{TagName: "proxy", WeaklyTypedInput: true})
 
 	proxies["DIRECT"] = adapters.NewProxy(adapters.NewDirect())
+	rejectPage, err := parseRejectPage(cfg.RejectPage)
+	if err != nil {
+		return nil, err
+	}
+
 	proxies["REJECT"] = adapters.NewProxy(adapters.NewReject())
-	proxyList = append(proxyList, "DIRECT", "REJECT")
+	proxies["REJECT-DROP"] = adapters.NewProxy(adapters.NewRejectDrop())
+	proxies["REJECT-PAGE"] = adapters.NewProxy(adapters.NewRejectPage(rejectPage))
+	proxyList = append(proxyList, "DIRECT", "REJECT", "REJECT-DROP", "REJECT-PAGE")
 
 	// parse proxy
 	for idx, mapping := range proxiesConfig {
@@ -269,6 +394,10 @@ func parseProxies(cfg *rawConfig) (map[string]C.Proxy, error) {
 			return nil, fmt.Errorf("Proxy %d missing type", idx)
 		}
 
+		if sourceIP, ok := mapping["source-ip"].(string); ok && net.ParseIP(sourceIP) == nil {
+			return nil, fmt.Errorf("Proxy %d source-ip: %s is not a valid ip", idx, sourceIP)
+		}
+
 		var proxy C.ProxyAdapter
 		err := fmt.Errorf("cannot parse")
 		switch proxyType {
@@ -292,14 +421,14 @@ func parseProxies(cfg *rawConfig) (map[string]C.Proxy, error) {
 			if err != nil {
 				break
 			}
-			proxy = adapters.NewSocks5(*socksOption)
+			proxy, err = adapters.NewSocks5(*socksOption)
 		case "http":
 			httpOption := &adapters.HttpOption{}
 			err = decoder.Decode(mapping, httpOption)
 			if err != nil {
 				break
 			}
-			proxy = adapters.NewHttp(*httpOption)
+			proxy, err = adapters.NewHttp(*httpOption)
 		case "snell":
 			snellOption := &adapters.SnellOption{}
 			err = decoder.Decode(mapping, snellOption)
@@ -314,6 +443,13 @@ func parseProxies(cfg *rawConfig) (map[string]C.Proxy, error) {
 				break
 			}
 			proxy, err = adapters.NewVmess(*vmessOption)
+		case "wireguard":
+			wgOption := &adapters.WireGuardOption{}
+			err = decoder.Decode(mapping, wgOption)
+			if err != nil {
+				break
+			}
+			proxy, err = adapters.NewWireGuard(*wgOption)
 		default:
 			return nil, fmt.Errorf("Unsupport proxy type: %s", proxyType)
 		}
@@ -529,7 +665,8 @@ func hostWithDefaultPort(host string, defPort string) (string, error) {
 	return net.JoinHostPort(hostname, port), nil
 }
 
-func parseNameServer(servers []string) ([]dns.NameServer, error) {
+// parseNameServer parse the nameservers, the fragment of a nameserver is the name of its proxy
+func parseNameServer(servers []string, proxies map[string]C.Proxy) ([]dns.NameServer, error) {
 	nameservers := []dns.NameServer{}
 
 	for idx, server := range servers {
@@ -565,17 +702,64 @@ func parseNameServer(servers []string) ([]dns.NameServer, error) {
 			return nil, fmt.Errorf("DNS NameServer[%d] format error: %s", idx, err.Error())
 		}
 
+		var proxy C.Proxy
+		if u.Fragment != "" {
+			p, exist := proxies[u.Fragment]
+			if !exist {
+				return nil, fmt.Errorf("DNS NameServer[%d] proxy %s not found", idx, u.Fragment)
+			}
+			proxy = p
+		}
+
 		nameservers = append(
 			nameservers,
 			dns.NameServer{
-				Net:  dnsNetType,
-				Addr: host,
+				Net:   dnsNetType,
+				Addr:  host,
+				Proxy: proxy,
 			},
 		)
 	}
 	return nameservers, nil
 }
 
+func parseNameServerPolicy(policy map[string]nameServerList, proxies map[string]C.Proxy) (map[string][]dns.NameServer, error) {
+	tree := trie.New()
+	result := map[string][]dns.NameServer{}
+	for domain, servers := range policy {
+		if err := tree.Insert(domain, struct{}{}); err != nil {
+			return nil, fmt.Errorf("DNS NameServerPolicy %s format error: %s", domain, err.Error())
+		}
+
+		nameservers, err := parseNameServer(servers, proxies)
+		if err != nil {
+			return nil, fmt.Errorf("DNS NameServerPolicy %s: %s", domain, err.Error())
+		}
+		if len(nameservers) == 0 {
+			return nil, fmt.Errorf("DNS NameServerPolicy %s: nameserver cannot be empty", domain)
+		}
+		result[domain] = nameservers
+	}
+	return result, nil
+}
+
+func parseFallbackDomain(domains []string, fallback []dns.NameServer) ([]string, error) {
+	if len(domains) == 0 {
+		return domains, nil
+	}
+	if len(fallback) == 0 {
+		return nil, fmt.Errorf("DNS FallbackFilter domain requires fallback nameservers")
+	}
+
+	tree := trie.New()
+	for _, domain := range domains {
+		if err := tree.Insert(domain, struct{}{}); err != nil {
+			return nil, fmt.Errorf("DNS FallbackFilter domain %s format error: %s", domain, err.Error())
+		}
+	}
+	return domains, nil
+}
+
 func parseFallbackIPCIDR(ips []string) ([]*net.IPNet, error) {
 	ipNets := []*net.IPNet{}
 
@@ -590,7 +774,257 @@ func parseFallbackIPCIDR(ips []string) ([]*net.IPNet, error) {
 	return ipNets, nil
 }
 
-func parseDNS(cfg rawDNS) (*DNS, error) {
+// parseFakeIPFilter build the trie of fake-ip-filter, the file has a domain per line
+// and is relative to the home dir, empty lines and lines starting with # are skipped
+func parseFakeIPFilter(domains []string, path string) (*trie.Trie, error) {
+	if path != "" {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(C.Path.HomeDir(), path)
+		}
+
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("DNS FakeIPFilter: %s", err.Error())
+		}
+
+		for _, line := range strings.Split(string(buf), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			domains = append(domains, line)
+		}
+	}
+
+	if len(domains) == 0 {
+		return nil, nil
+	}
+
+	tree := trie.New()
+	for _, domain := range domains {
+		if err := tree.Insert(domain, struct{}{}); err != nil {
+			return nil, fmt.Errorf("DNS FakeIPFilter %s format error: %s", domain, err.Error())
+		}
+	}
+	return tree, nil
+}
+
+// parseCertificate load the certificate of DNS over TLS and HTTPS, the paths are relative to the home dir
+func parseCertificate(certificate, privateKey string) (*tls.Certificate, error) {
+	if certificate == "" || privateKey == "" {
+		return nil, fmt.Errorf("DNS certificate and private-key are required by tls-listen and https-listen")
+	}
+
+	if !filepath.IsAbs(certificate) {
+		certificate = filepath.Join(C.Path.HomeDir(), certificate)
+	}
+	if !filepath.IsAbs(privateKey) {
+		privateKey = filepath.Join(C.Path.HomeDir(), privateKey)
+	}
+
+	cert, err := tls.LoadX509KeyPair(certificate, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("DNS certificate error: %s", err.Error())
+	}
+	return &cert, nil
+}
+
+func parseDNSCache(cfg rawDNSCache) (dns.CacheConfig, error) {
+	if cfg.Size <= 0 {
+		return dns.CacheConfig{}, fmt.Errorf("DNS Cache size must be positive")
+	}
+	if cfg.MinTTL < 0 || cfg.MaxTTL < 0 || cfg.MaxStale < 0 {
+		return dns.CacheConfig{}, fmt.Errorf("DNS Cache ttl cannot be negative")
+	}
+	if cfg.MaxTTL != 0 && cfg.MinTTL > cfg.MaxTTL {
+		return dns.CacheConfig{}, fmt.Errorf("DNS Cache min-ttl %d is larger than max-ttl %d", cfg.MinTTL, cfg.MaxTTL)
+	}
+
+	return dns.CacheConfig{
+		Size:       cfg.Size,
+		MinTTL:     time.Duration(cfg.MinTTL) * time.Second,
+		MaxTTL:     time.Duration(cfg.MaxTTL) * time.Second,
+		ServeStale: cfg.ServeStale,
+		MaxStale:   time.Duration(cfg.MaxStale) * time.Second,
+		Prefetch:   cfg.Prefetch,
+	}, nil
+}
+
+func parseBlocklist(cfg rawBlocklist) (*dns.Blocker, error) {
+	if len(cfg.Lists) == 0 {
+		return nil, nil
+	}
+
+	response := dns.BlockNXDomain
+	if cfg.Response != "" {
+		var exist bool
+		if response, exist = dns.BlockResponseMapping[strings.ToLower(cfg.Response)]; !exist {
+			return nil, fmt.Errorf("DNS Blocklist response %s is not supported", cfg.Response)
+		}
+	}
+
+	names := map[string]bool{}
+	lists := []*dns.BlockList{}
+	for idx, list := range cfg.Lists {
+		if list.Name == "" || list.Path == "" {
+			return nil, fmt.Errorf("DNS Blocklist %d: name and path are required", idx)
+		}
+		if names[list.Name] {
+			return nil, fmt.Errorf("DNS Blocklist %s is duplicate", list.Name)
+		}
+		names[list.Name] = true
+
+		path := list.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(C.Path.HomeDir(), path)
+		}
+		lists = append(lists, &dns.BlockList{Name: list.Name, Path: path})
+	}
+
+	blocker, err := dns.NewBlocker(lists, response)
+	if err != nil {
+		return nil, fmt.Errorf("DNS Blocklist error: %s", err.Error())
+	}
+	return blocker, nil
+}
+
+// proxyServerHosts return the server hostnames of the proxy name, the groups are walked through recursively
+func proxyServerHosts(cfg *rawConfig, name string) []string {
+	servers := map[string]string{}
+	for _, mapping := range cfg.Proxy {
+		proxyName, _ := mapping["name"].(string)
+		server, _ := mapping["server"].(string)
+		servers[proxyName] = server
+	}
+
+	members := map[string][]string{}
+	for _, mapping := range cfg.ProxyGroup {
+		groupName, _ := mapping["name"].(string)
+		list, _ := mapping["proxies"].([]interface{})
+		for _, member := range list {
+			if memberName, ok := member.(string); ok {
+				members[groupName] = append(members[groupName], memberName)
+			}
+		}
+	}
+
+	hosts := []string{}
+	visited := map[string]bool{}
+	var walk func(name string)
+	walk = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+
+		if server := servers[name]; server != "" && net.ParseIP(server) == nil {
+			hosts = append(hosts, server)
+		}
+		for _, member := range members[name] {
+			walk(member)
+		}
+	}
+	walk(name)
+	return hosts
+}
+
+// parseProxyServers return the server hostnames of the proxies used by the nameservers,
+// they are resolved by the nameservers without proxy, or the queries would loop through the proxies
+func parseProxyServers(cfg *rawConfig, dnsCfg *DNS) ([]string, error) {
+	nameservers := append([]dns.NameServer{}, dnsCfg.NameServer...)
+	nameservers = append(nameservers, dnsCfg.Fallback...)
+	for _, servers := range dnsCfg.NameServerPolicy {
+		nameservers = append(nameservers, servers...)
+	}
+
+	hosts := []string{}
+	for _, ns := range nameservers {
+		if ns.Proxy != nil {
+			hosts = append(hosts, proxyServerHosts(cfg, ns.Proxy.Name())...)
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, nil
+	}
+
+	for _, ns := range dnsCfg.NameServer {
+		if ns.Proxy == nil {
+			return hosts, nil
+		}
+	}
+	return nil, fmt.Errorf("DNS NameServer: the proxy servers %s need a nameserver without proxy to be resolved", strings.Join(hosts, ", "))
+}
+
+// isPlainNameServer return whether ns is udp or tcp with ip, which needs no other nameserver to bootstrap
+func isPlainNameServer(ns dns.NameServer) bool {
+	if ns.Net != "" && ns.Net != "tcp" {
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(ns.Addr)
+	return err == nil && net.ParseIP(host) != nil
+}
+
+// nameServerHost return the hostname of ns, empty if it is an ip
+func nameServerHost(ns dns.NameServer) string {
+	host := ns.Addr
+	if ns.Net == "https" {
+		if u, err := url.Parse(ns.Addr); err == nil {
+			host = u.Host
+		}
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	return host
+}
+
+// parseDefaultNameServer parse the nameservers resolving the hostnames of the other nameservers,
+// the plain ones of nameserver are used if it is empty
+func parseDefaultNameServer(servers []string, dnsCfg *DNS) ([]dns.NameServer, error) {
+	nameservers, err := parseNameServer(servers, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, ns := range nameservers {
+		if !isPlainNameServer(ns) {
+			return nil, fmt.Errorf("DNS DefaultNameServer[%d] only support udp or tcp with ip: %s", idx, servers[idx])
+		}
+	}
+
+	// the queries through a proxy resolve the hostname at the remote
+	needed := []string{}
+	upstreams := append(append([]dns.NameServer{}, dnsCfg.NameServer...), dnsCfg.Fallback...)
+	for _, servers := range dnsCfg.NameServerPolicy {
+		upstreams = append(upstreams, servers...)
+	}
+	for _, ns := range upstreams {
+		if host := nameServerHost(ns); host != "" && ns.Proxy == nil {
+			needed = append(needed, host)
+		}
+	}
+	if len(needed) == 0 || len(nameservers) != 0 {
+		return nameservers, nil
+	}
+
+	for _, ns := range dnsCfg.NameServer {
+		if isPlainNameServer(ns) && ns.Proxy == nil {
+			nameservers = append(nameservers, ns)
+		}
+	}
+	if len(nameservers) == 0 {
+		return nil, fmt.Errorf("DNS DefaultNameServer cannot be empty, it is needed to resolve %s", strings.Join(needed, ", "))
+	}
+	return nameservers, nil
+}
+
+func parseDNS(rawCfg *rawConfig, proxies map[string]C.Proxy) (*DNS, error) {
+	cfg := rawCfg.DNS
 	if cfg.Enable && len(cfg.NameServer) == 0 {
 		return nil, fmt.Errorf("If DNS configuration is turned on, NameServer cannot be empty")
 	}
@@ -598,6 +1032,8 @@ func parseDNS(cfg rawDNS) (*DNS, error) {
 	dnsCfg := &DNS{
 		Enable:       cfg.Enable,
 		Listen:       cfg.Listen,
+		TLSListen:    cfg.TLSListen,
+		HTTPSListen:  cfg.HTTPSListen,
 		IPv6:         cfg.IPv6,
 		EnhancedMode: cfg.EnhancedMode,
 		FallbackFilter: FallbackFilter{
@@ -605,18 +1041,30 @@ func parseDNS(cfg rawDNS) (*DNS, error) {
 		},
 	}
 	var err error
-	if dnsCfg.NameServer, err = parseNameServer(cfg.NameServer); err != nil {
+	if dnsCfg.NameServer, err = parseNameServer(cfg.NameServer, proxies); err != nil {
+		return nil, err
+	}
+
+	if dnsCfg.Fallback, err = parseNameServer(cfg.Fallback, proxies); err != nil {
+		return nil, err
+	}
+
+	if dnsCfg.NameServerPolicy, err = parseNameServerPolicy(cfg.NameServerPolicy, proxies); err != nil {
+		return nil, err
+	}
+
+	if dnsCfg.ProxyServers, err = parseProxyServers(rawCfg, dnsCfg); err != nil {
 		return nil, err
 	}
 
-	if dnsCfg.Fallback, err = parseNameServer(cfg.Fallback); err != nil {
+	if dnsCfg.DefaultNameServer, err = parseDefaultNameServer(cfg.DefaultNameServer, dnsCfg); err != nil {
 		return nil, err
 	}
 
 	if cfg.EnhancedMode == dns.FAKEIP {
 		_, ipnet, err := net.ParseCIDR(cfg.FakeIPRange)
-		if err != nil {
-			return nil, err
+		if err != nil || ipnet.IP.To4() == nil {
+			return nil, fmt.Errorf("DNS FakeIPRange %s is not a valid IPv4 range", cfg.FakeIPRange)
 		}
 		pool, err := fakeip.New(ipnet, 1000)
 		if err != nil {
@@ -624,12 +1072,51 @@ func parseDNS(cfg rawDNS) (*DNS, error) {
 		}
 
 		dnsCfg.FakeIPRange = pool
+
+		if cfg.FakeIPRange6 != "" {
+			_, ipnet, err := net.ParseCIDR(cfg.FakeIPRange6)
+			if err != nil || ipnet.IP.To4() != nil {
+				return nil, fmt.Errorf("DNS FakeIPRange6 %s is not a valid IPv6 range", cfg.FakeIPRange6)
+			}
+			pool, err := fakeip.New(ipnet, 1000)
+			if err != nil {
+				return nil, err
+			}
+
+			dnsCfg.FakeIPRange6 = pool
+		}
+
+		if dnsCfg.FakeIPFilter, err = parseFakeIPFilter(cfg.FakeIPFilter, cfg.FakeIPFilterFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if dnsCfg.Cache, err = parseDNSCache(cfg.Cache); err != nil {
+		return nil, err
+	}
+
+	if dnsCfg.Blocker, err = parseBlocklist(cfg.Blocklist); err != nil {
+		return nil, err
+	}
+
+	if cfg.TLSListen != "" || cfg.HTTPSListen != "" {
+		if dnsCfg.Certificate, err = parseCertificate(cfg.Certificate, cfg.PrivateKey); err != nil {
+			return nil, err
+		}
 	}
 
 	dnsCfg.FallbackFilter.GeoIP = cfg.FallbackFilter.GeoIP
 	if fallbackip, err := parseFallbackIPCIDR(cfg.FallbackFilter.IPCIDR); err == nil {
 		dnsCfg.FallbackFilter.IPCIDR = fallbackip
 	}
+	dnsCfg.FallbackFilter.IPCIDRInvert = cfg.FallbackFilter.IPCIDRInvert
+	if dnsCfg.FallbackFilter.IPCIDRInvert && len(dnsCfg.FallbackFilter.IPCIDR) == 0 {
+		return nil, fmt.Errorf("DNS FallbackFilter ipcidr-invert requires ipcidr")
+	}
+
+	if dnsCfg.FallbackFilter.Domain, err = parseFallbackDomain(cfg.FallbackFilter.Domain, dnsCfg.Fallback); err != nil {
+		return nil, err
+	}
 
 	return dnsCfg, nil
 }
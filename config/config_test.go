@@ -0,0 +1,274 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// parseTestDNS parse the dns section of a configuration with content
+func parseTestDNS(t *testing.T, content string) (*DNS, error) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+
+	rawCfg, err := readConfig(path)
+	assert.Nil(t, err)
+	return parseDNS(rawCfg, nil)
+}
+
+func TestParseDNS_FallbackFilter(t *testing.T) {
+	dnsCfg, err := parseTestDNS(t, `
+dns:
+  enable: true
+  nameserver: [114.114.114.114]
+  fallback: [8.8.8.8]
+  fallback-filter:
+    ipcidr: [240.0.0.0/4]
+    ipcidr-invert: true
+    domain: ['+.google.com']
+`)
+	assert.Nil(t, err)
+	assert.True(t, dnsCfg.FallbackFilter.GeoIP)
+	assert.True(t, dnsCfg.FallbackFilter.IPCIDRInvert)
+	assert.Len(t, dnsCfg.FallbackFilter.IPCIDR, 1)
+	assert.Equal(t, []string{"+.google.com"}, dnsCfg.FallbackFilter.Domain)
+
+	_, err = parseTestDNS(t, `
+dns:
+  enable: true
+  nameserver: [114.114.114.114]
+  fallback: [8.8.8.8]
+  fallback-filter:
+    ipcidr-invert: true
+`)
+	assert.Error(t, err)
+
+	_, err = parseTestDNS(t, `
+dns:
+  enable: true
+  nameserver: [114.114.114.114]
+  fallback-filter:
+    domain: ['+.google.com']
+`)
+	assert.Error(t, err)
+}
+
+func TestParseDNS_NameServerPolicy(t *testing.T) {
+	dnsCfg, err := parseTestDNS(t, `
+dns:
+  enable: true
+  nameserver: [114.114.114.114]
+  nameserver-policy:
+    '+.corp.example.com': 10.0.0.53
+    'www.example.com': [tls://1.1.1.1:853, https://1.1.1.1/dns-query]
+`)
+	assert.Nil(t, err)
+	assert.Len(t, dnsCfg.NameServerPolicy["+.corp.example.com"], 1)
+	assert.Equal(t, "10.0.0.53:53", dnsCfg.NameServerPolicy["+.corp.example.com"][0].Addr)
+	assert.Len(t, dnsCfg.NameServerPolicy["www.example.com"], 2)
+
+	for _, policy := range []string{
+		`'+.corp.example.com': []`,
+		`'..example.com': 10.0.0.53`,
+		`'www.example.com': 'ftp://10.0.0.53'`,
+		`'www.example.com': '10.0.0.53#Proxy'`,
+	} {
+		_, err = parseTestDNS(t, `
+dns:
+  enable: true
+  nameserver: [114.114.114.114]
+  nameserver-policy:
+    `+policy+`
+`)
+		assert.Error(t, err, policy)
+	}
+}
+
+func TestParseDNS_FakeIPFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "filter.txt")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("# local names\n+.lan\n\n  time.*.com  \n"), 0644))
+
+	dnsCfg, err := parseTestDNS(t, `
+dns:
+  enable: true
+  nameserver: [114.114.114.114]
+  enhanced-mode: fake-ip
+  fake-ip-filter: ['+.stun.example.com']
+  fake-ip-filter-file: `+path+`
+`)
+	assert.Nil(t, err)
+	for _, domain := range []string{"nas.lan", "time.windows.com", "a.stun.example.com"} {
+		assert.NotNil(t, dnsCfg.FakeIPFilter.Search(domain), domain)
+	}
+	assert.Nil(t, dnsCfg.FakeIPFilter.Search("example.com"))
+
+	_, err = parseTestDNS(t, `
+dns:
+  enable: true
+  nameserver: [114.114.114.114]
+  enhanced-mode: fake-ip
+  fake-ip-filter-file: `+filepath.Join(dir, "missing.txt")+`
+`)
+	assert.Error(t, err)
+}
+
+func TestParseDNS_FakeIPRange6(t *testing.T) {
+	dnsCfg, err := parseTestDNS(t, `
+dns:
+  enable: true
+  nameserver: [114.114.114.114]
+  enhanced-mode: fake-ip
+  fake-ip-range6: 'fdfe:dcba:9876::1/64'
+`)
+	assert.Nil(t, err)
+	assert.True(t, dnsCfg.FakeIPRange6.IPv6())
+
+	for _, cidr := range []string{"198.18.0.1/16", "fdfe::"} {
+		_, err = parseTestDNS(t, `
+dns:
+  enable: true
+  nameserver: [114.114.114.114]
+  enhanced-mode: fake-ip
+  fake-ip-range6: '`+cidr+`'
+`)
+		assert.Error(t, err, cidr)
+	}
+}
+
+func TestParseDNS_Cache(t *testing.T) {
+	dnsCfg, err := parseTestDNS(t, `
+dns:
+  enable: true
+  nameserver: [114.114.114.114]
+  cache:
+    min-ttl: 60
+    max-ttl: 3600
+    serve-stale: true
+    prefetch: true
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, 4096, dnsCfg.Cache.Size)
+	assert.Equal(t, time.Minute, dnsCfg.Cache.MinTTL)
+	assert.Equal(t, time.Hour, dnsCfg.Cache.MaxTTL)
+	assert.Equal(t, 24*time.Hour, dnsCfg.Cache.MaxStale)
+	assert.True(t, dnsCfg.Cache.ServeStale)
+	assert.True(t, dnsCfg.Cache.Prefetch)
+
+	for _, cache := range []string{"{size: 0}", "{min-ttl: -1}", "{min-ttl: 600, max-ttl: 60}"} {
+		_, err = parseTestDNS(t, `
+dns:
+  enable: true
+  nameserver: [114.114.114.114]
+  cache: `+cache+`
+`)
+		assert.Error(t, err, cache)
+	}
+}
+
+func TestParseDNS_DefaultNameServer(t *testing.T) {
+	dnsCfg, err := parseTestDNS(t, `
+dns:
+  enable: true
+  default-nameserver: [223.5.5.5, 'tcp://119.29.29.29']
+  nameserver: ['tls://dns.rubyfish.cn:853', 'https://dns.google/dns-query']
+`)
+	assert.Nil(t, err)
+	assert.Len(t, dnsCfg.DefaultNameServer, 2)
+
+	// the plain nameservers resolve the others without default-nameserver
+	dnsCfg, err = parseTestDNS(t, `
+dns:
+  enable: true
+  nameserver: [114.114.114.114, 'tls://dns.rubyfish.cn:853']
+`)
+	assert.Nil(t, err)
+	if assert.Len(t, dnsCfg.DefaultNameServer, 1) {
+		assert.Equal(t, "114.114.114.114:53", dnsCfg.DefaultNameServer[0].Addr)
+	}
+
+	for _, dns := range []string{
+		// nothing resolves the hostnames
+		`
+  nameserver: ['tls://dns.rubyfish.cn:853']`,
+		// default-nameserver only support plain ones with ip
+		`
+  nameserver: [114.114.114.114]
+  default-nameserver: ['dns.example.com']`,
+		`
+  nameserver: [114.114.114.114]
+  default-nameserver: ['tls://1.1.1.1:853']`,
+	} {
+		_, err = parseTestDNS(t, `
+dns:
+  enable: true`+dns+`
+`)
+		assert.Error(t, err, dns)
+	}
+}
+
+func TestParseDNS_Listeners(t *testing.T) {
+	for _, listen := range []string{
+		`
+  tls-listen: 127.0.0.1:853`,
+		`
+  https-listen: 127.0.0.1:443
+  certificate: missing.crt
+  private-key: missing.key`,
+	} {
+		_, err := parseTestDNS(t, `
+dns:
+  enable: true
+  nameserver: [114.114.114.114]`+listen+`
+`)
+		assert.Error(t, err, listen)
+	}
+}
+
+func TestParseDNS_Blocklist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ads.txt")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("ads.example.com\n"), 0644))
+
+	dnsCfg, err := parseTestDNS(t, `
+dns:
+  enable: true
+  nameserver: [114.114.114.114]
+  blocklist:
+    response: Zero
+    lists:
+      - name: ads
+        path: `+path+`
+`)
+	assert.Nil(t, err)
+	if assert.NotNil(t, dnsCfg.Blocker) {
+		assert.NotNil(t, dnsCfg.Blocker.Match("ads.example.com"))
+	}
+
+	for _, blocklist := range []string{
+		`{response: drop, lists: [{name: ads, path: ` + path + `}]}`,
+		`{lists: [{name: ads}]}`,
+		`{lists: [{name: ads, path: ` + path + `}, {name: ads, path: ` + path + `}]}`,
+		`{lists: [{name: missing, path: ` + filepath.Join(dir, "missing.txt") + `}]}`,
+	} {
+		_, err = parseTestDNS(t, `
+dns:
+  enable: true
+  nameserver: [114.114.114.114]
+  blocklist: `+blocklist+`
+`)
+		assert.Error(t, err, blocklist)
+	}
+}
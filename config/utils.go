@@ -28,6 +28,12 @@ func getProxies(mapping map[string]C.Proxy, list []string) ([]C.Proxy, error) {
 	return ps, nil
 }
 
+func destroyProxies(proxies map[string]C.Proxy) {
+	for _, proxy := range proxies {
+		proxy.Destroy()
+	}
+}
+
 func or(pointers ...*int) *int {
 	for _, p := range pointers {
 		if p != nil {
@@ -12,6 +12,8 @@ const (
 	Direct AdapterType = iota
 	Fallback
 	Reject
+	RejectDrop
+	RejectPage
 	Selector
 	Shadowsocks
 	ShadowsocksR
@@ -21,6 +23,7 @@ const (
 	URLTest
 	Vmess
 	LoadBalance
+	WireGuard
 )
 
 type ServerAdapter interface {
@@ -67,8 +70,9 @@ type ProxyAdapter interface {
 }
 
 type DelayHistory struct {
-	Time  time.Time `json:"time"`
-	Delay uint16    `json:"delay"`
+	Time    time.Time `json:"time"`
+	Delay   uint16    `json:"delay"`
+	Failure string    `json:"failure,omitempty"`
 }
 
 type Proxy interface {
@@ -91,6 +95,10 @@ func (at AdapterType) String() string {
 		return "Fallback"
 	case Reject:
 		return "Reject"
+	case RejectDrop:
+		return "RejectDrop"
+	case RejectPage:
+		return "RejectPage"
 	case Selector:
 		return "Selector"
 	case Shadowsocks:
@@ -109,6 +117,8 @@ func (at AdapterType) String() string {
 		return "Vmess"
 	case LoadBalance:
 		return "LoadBalance"
+	case WireGuard:
+		return "WireGuard"
 	default:
 		return "Unknown"
 	}
@@ -14,6 +14,7 @@ const (
 	UDP
 
 	HTTP Type = iota
+	HTTPCONNECT
 	SOCKS
 	REDIR
 )
@@ -40,3 +40,11 @@ func (p *path) Config() string {
 func (p *path) MMDB() string {
 	return P.Join(p.homedir, "Country.mmdb")
 }
+
+func (p *path) Selected() string {
+	return P.Join(p.homedir, "selected.json")
+}
+
+func (p *path) FakeIP() string {
+	return P.Join(p.homedir, "fakeip.json")
+}
@@ -0,0 +1,204 @@
+package dns
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	trie "github.com/ClashrAuto/Clashr/component/domain-trie"
+
+	D "github.com/miekg/dns"
+)
+
+// BlockResponse is the reply to the blocked queries
+type BlockResponse int
+
+const (
+	// BlockNXDomain reply NXDOMAIN
+	BlockNXDomain BlockResponse = iota
+	// BlockZero reply 0.0.0.0 or :: to A and AAAA, and no answer to the others
+	BlockZero
+	// BlockRefused reply REFUSED
+	BlockRefused
+)
+
+// BlockResponseMapping is a mapping for BlockResponse enum
+var BlockResponseMapping = map[string]BlockResponse{
+	"nxdomain": BlockNXDomain,
+	"zero":     BlockZero,
+	"refused":  BlockRefused,
+}
+
+// BlockList is a file of blocked domains, in hosts format or a domain per line
+type BlockList struct {
+	// hits is accessed atomically, keep it first for the 64-bit alignment
+	hits    uint64
+	domains int
+
+	Name string
+	Path string
+}
+
+// BlockListStats is the counters of a block list
+type BlockListStats struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Domains int    `json:"domains"`
+	Hits    uint64 `json:"hits"`
+}
+
+// Blocker match the queries against the block lists
+type Blocker struct {
+	response BlockResponse
+	lists    []*BlockList
+
+	mux  sync.RWMutex
+	tree *trie.Trie
+}
+
+// Match return the block list containing domain, nil if it is not blocked
+func (b *Blocker) Match(domain string) *BlockList {
+	b.mux.RLock()
+	tree := b.tree
+	b.mux.RUnlock()
+
+	if node := tree.Search(domain); node != nil {
+		return node.Data.(*BlockList)
+	}
+	return nil
+}
+
+// Reload read all the block lists again, the lists are unchanged if any of them fails
+func (b *Blocker) Reload() error {
+	tree := trie.New()
+	counts := make([]int, len(b.lists))
+	for idx, list := range b.lists {
+		count, err := list.load(tree)
+		if err != nil {
+			return err
+		}
+		counts[idx] = count
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.tree = tree
+	for idx, list := range b.lists {
+		list.domains = counts[idx]
+	}
+	return nil
+}
+
+// Stats return the counters of the block lists
+func (b *Blocker) Stats() []BlockListStats {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+
+	stats := []BlockListStats{}
+	for _, list := range b.lists {
+		stats = append(stats, BlockListStats{
+			Name:    list.Name,
+			Path:    list.Path,
+			Domains: list.domains,
+			Hits:    atomic.LoadUint64(&list.hits),
+		})
+	}
+	return stats
+}
+
+// block count a hit of list and return the message answering the blocked query r
+func (b *Blocker) block(list *BlockList, r *D.Msg) *D.Msg {
+	atomic.AddUint64(&list.hits, 1)
+	return b.reply(r)
+}
+
+// reply return the message answering the blocked query r
+func (b *Blocker) reply(r *D.Msg) *D.Msg {
+	msg := &D.Msg{}
+	switch b.response {
+	case BlockRefused:
+		msg.SetRcode(r, D.RcodeRefused)
+	case BlockZero:
+		msg.SetReply(r)
+		q := r.Question[0]
+		hdr := D.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: D.ClassINET, Ttl: dnsDefaultTTL}
+		switch q.Qtype {
+		case D.TypeA:
+			msg.Answer = []D.RR{&D.A{Hdr: hdr, A: net.IPv4zero}}
+		case D.TypeAAAA:
+			msg.Answer = []D.RR{&D.AAAA{Hdr: hdr, AAAA: net.IPv6zero}}
+		}
+	default:
+		msg.SetRcode(r, D.RcodeNameError)
+	}
+	return msg
+}
+
+// load insert the domains of the list to tree, the domains already in tree are kept
+func (l *BlockList) load(tree *trie.Trie) (int, error) {
+	f, err := os.Open(l.Path)
+	if err != nil {
+		return 0, fmt.Errorf("block list %s: %s", l.Name, err.Error())
+	}
+	defer f.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.IndexByte(line, '#'); idx != -1 {
+			line = line[:idx]
+		}
+
+		fields := strings.Fields(line)
+		// hosts format, the domains follow the address
+		if len(fields) > 1 && net.ParseIP(fields[0]) != nil {
+			fields = fields[1:]
+		}
+
+		for _, domain := range fields {
+			domain = strings.ToLower(strings.TrimRight(domain, "."))
+			if isHostsAlias(domain) || net.ParseIP(domain) != nil {
+				continue
+			}
+			if node := tree.Search(domain); node != nil {
+				continue
+			}
+			if tree.Insert(domain, l) == nil {
+				count++
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("block list %s: %s", l.Name, err.Error())
+	}
+	return count, nil
+}
+
+// isHostsAlias return whether domain is one of the local names in the hosts files, they are never blocked
+func isHostsAlias(domain string) bool {
+	switch domain {
+	case "localhost", "localhost.localdomain", "local", "broadcasthost", "ip6-localhost", "ip6-loopback":
+		return true
+	}
+	return false
+}
+
+// NewBlocker load the block lists
+func NewBlocker(lists []*BlockList, response BlockResponse) (*Blocker, error) {
+	if len(lists) == 0 {
+		return nil, errors.New("block lists cannot be empty")
+	}
+
+	blocker := &Blocker{response: response, lists: lists}
+	if err := blocker.Reload(); err != nil {
+		return nil, err
+	}
+	return blocker, nil
+}
@@ -0,0 +1,137 @@
+package dns
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeList(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestBlockList_Parse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blocklist")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	hosts := writeList(t, dir, "hosts", `# hosts format
+127.0.0.1 localhost
+::1 ip6-localhost ip6-loopback
+0.0.0.0 Ads.Example.com tracker.example.com # trailing comment
+0.0.0.0 telemetry.example.net.
+`)
+	plain := writeList(t, dir, "plain", `# a domain per line
++.doubleclick.net
+ads.example.com
+
+0.0.0.0
+`)
+
+	blocker, err := NewBlocker([]*BlockList{{Name: "hosts", Path: hosts}, {Name: "plain", Path: plain}}, BlockNXDomain)
+	assert.Nil(t, err)
+
+	for domain, list := range map[string]string{
+		"ads.example.com":       "hosts",
+		"tracker.example.com":   "hosts",
+		"telemetry.example.net": "hosts",
+		"doubleclick.net":       "plain",
+		"ad.doubleclick.net":    "plain",
+	} {
+		if assert.NotNil(t, blocker.Match(domain), domain) {
+			assert.Equal(t, list, blocker.Match(domain).Name, domain)
+		}
+	}
+	for _, domain := range []string{"localhost", "ip6-localhost", "example.com", "0.0.0.0"} {
+		assert.Nil(t, blocker.Match(domain), domain)
+	}
+
+	// the first list wins the domains in both
+	stats := blocker.Stats()
+	assert.Equal(t, 3, stats[0].Domains)
+	assert.Equal(t, 1, stats[1].Domains)
+}
+
+func TestBlocker_Response(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blocklist")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := writeList(t, dir, "plain", "ads.example.com\n")
+
+	for _, tt := range []struct {
+		response BlockResponse
+		qtype    uint16
+		rcode    int
+		answer   D.RR
+	}{
+		{BlockNXDomain, D.TypeA, D.RcodeNameError, nil},
+		{BlockRefused, D.TypeA, D.RcodeRefused, nil},
+		{BlockZero, D.TypeA, D.RcodeSuccess, &D.A{A: net.IPv4zero}},
+		{BlockZero, D.TypeAAAA, D.RcodeSuccess, &D.AAAA{AAAA: net.IPv6zero}},
+		{BlockZero, D.TypeTXT, D.RcodeSuccess, nil},
+	} {
+		blocker, err := NewBlocker([]*BlockList{{Name: "plain", Path: path}}, tt.response)
+		assert.Nil(t, err)
+
+		h := newHandler(newTestResolver(Config{Blocker: blocker}, newFakeClient(60, "10.0.0.1")))
+		w := &recordWriter{local: &net.UDPAddr{}}
+		// the names are matched case-insensitively
+		h(w, query("ADS.example.com", tt.qtype))
+
+		assert.Equal(t, tt.rcode, w.msg.Rcode)
+		switch answer := tt.answer.(type) {
+		case *D.A:
+			if assert.Len(t, w.msg.Answer, 1) {
+				assert.True(t, answer.A.Equal(w.msg.Answer[0].(*D.A).A))
+			}
+		case *D.AAAA:
+			if assert.Len(t, w.msg.Answer, 1) {
+				assert.True(t, answer.AAAA.Equal(w.msg.Answer[0].(*D.AAAA).AAAA))
+			}
+		default:
+			assert.Empty(t, w.msg.Answer)
+		}
+		assert.Equal(t, uint64(1), blocker.Stats()[0].Hits)
+	}
+
+	// the others are resolved
+	blocker, err := NewBlocker([]*BlockList{{Name: "plain", Path: path}}, BlockNXDomain)
+	assert.Nil(t, err)
+	h := newHandler(newTestResolver(Config{Blocker: blocker}, newFakeClient(60, "10.0.0.1")))
+	w := &recordWriter{local: &net.UDPAddr{}}
+	h(w, query("example.com", D.TypeA))
+	assert.Equal(t, D.RcodeSuccess, w.msg.Rcode)
+	assert.Len(t, w.msg.Answer, 1)
+}
+
+func TestBlocker_Reload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blocklist")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	first := writeList(t, dir, "first", "ads.example.com\n")
+	second := writeList(t, dir, "second", "tracker.example.com\n")
+
+	blocker, err := NewBlocker([]*BlockList{{Name: "first", Path: first}, {Name: "second", Path: second}}, BlockNXDomain)
+	assert.Nil(t, err)
+
+	writeList(t, dir, "first", "ads.example.com\nmore.example.com\n")
+	assert.Nil(t, blocker.Reload())
+	assert.NotNil(t, blocker.Match("more.example.com"))
+	assert.Equal(t, 2, blocker.Stats()[0].Domains)
+
+	// a missing list keeps the old tree and counters
+	writeList(t, dir, "first", "other.example.com\n")
+	assert.Nil(t, os.Remove(second))
+	assert.Error(t, blocker.Reload())
+	assert.NotNil(t, blocker.Match("more.example.com"))
+	assert.NotNil(t, blocker.Match("tracker.example.com"))
+	assert.Nil(t, blocker.Match("other.example.com"))
+	assert.Equal(t, 2, blocker.Stats()[0].Domains)
+}
@@ -0,0 +1,210 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClashrAuto/Clashr/common/cache"
+	"github.com/ClashrAuto/Clashr/log"
+
+	D "github.com/miekg/dns"
+)
+
+const (
+	defaultCacheSize = 4096
+
+	// staleAnswerTTL is the ttl of expired answers, as recommended by RFC 8767
+	staleAnswerTTL = 30
+
+	// an entry is prefetched after prefetchHits hits, once less than 1/prefetchRatio of its ttl remains
+	prefetchHits  = 2
+	prefetchRatio = 10
+)
+
+// CacheConfig is the options of the dns cache, the zero value is a cache of the default size
+type CacheConfig struct {
+	// Size is the max count of entries, the least recently used are evicted,
+	// the ip to host mapping of redir-host and fake-ip mode has a cap of the same size apart
+	Size int
+	// MinTTL and MaxTTL clamp the ttl of the upstream replies, zero means no clamp
+	MinTTL time.Duration
+	MaxTTL time.Duration
+	// ServeStale answer the entries expired within MaxStale and refresh them in the background
+	ServeStale bool
+	MaxStale   time.Duration
+	// Prefetch refresh the popular entries before they expire
+	Prefetch bool
+}
+
+// CacheStats is the counters of the dns cache
+type CacheStats struct {
+	Size     int    `json:"size"`
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
+	Stale    uint64 `json:"stale"`
+	Prefetch uint64 `json:"prefetch"`
+}
+
+type cacheEntry struct {
+	msg     *D.Msg
+	ttl     time.Duration
+	expires time.Time
+
+	hits        uint32
+	prefetching int32
+}
+
+// remaining return the ttl left, it is negative once expired
+func (e *cacheEntry) remaining() time.Duration {
+	return time.Until(e.expires)
+}
+
+// hostEntry is the host an ip of the replies maps back to in redir-host and fake-ip mode
+type hostEntry struct {
+	host    string
+	expires time.Time
+}
+
+// msgCache store the replies by question, with a size cap and LRU eviction
+type msgCache struct {
+	// the counters are accessed atomically, keep them first for the 64-bit alignment
+	hits     uint64
+	misses   uint64
+	stale    uint64
+	prefetch uint64
+
+	config CacheConfig
+	lru    *cache.LruCache
+	// hosts is the ip to host mapping, kept apart so that it never evicts the replies
+	hosts *cache.LruCache
+}
+
+// get return the entry of key, stale is true if it is expired but still in the serve-stale window
+func (c *msgCache) get(key string) (entry *cacheEntry, stale bool) {
+	item, exist := c.lru.Get(key)
+	if !exist {
+		return nil, false
+	}
+
+	entry = item.(*cacheEntry)
+	remaining := entry.remaining()
+	if remaining > 0 {
+		return entry, false
+	}
+
+	if !c.config.ServeStale || -remaining > c.config.MaxStale {
+		c.lru.Delete(key)
+		return nil, false
+	}
+	return entry, true
+}
+
+// put store msg with its ttl clamped
+func (c *msgCache) put(key string, msg *D.Msg) {
+	ttl, ok := msgTTL(msg)
+	if !ok {
+		log.Debugln("[DNS] response msg error: %#v", msg)
+		return
+	}
+
+	ttl = c.clampTTL(ttl)
+	c.lru.Set(key, &cacheEntry{
+		msg:     msg.Copy(),
+		ttl:     ttl,
+		expires: time.Now().Add(ttl),
+	})
+}
+
+// putHosts map the ips of msg back to the host of its question for its clamped ttl
+func (c *msgCache) putHosts(msg *D.Msg, ips []net.IP) {
+	ttl, ok := msgTTL(msg)
+	if !ok || len(msg.Question) == 0 {
+		return
+	}
+
+	entry := &hostEntry{
+		host:    strings.TrimRight(msg.Question[0].Name, "."),
+		expires: time.Now().Add(c.clampTTL(ttl)),
+	}
+	for _, ip := range ips {
+		c.hosts.Set(ip.String(), entry)
+	}
+}
+
+// getHost return the host ip maps back to, the mapping lasts as long as the stale answers are served
+func (c *msgCache) getHost(ip net.IP) (string, bool) {
+	item, exist := c.hosts.Get(ip.String())
+	if !exist {
+		return "", false
+	}
+
+	entry := item.(*hostEntry)
+	expired := time.Since(entry.expires)
+	if expired > 0 && (!c.config.ServeStale || expired > c.config.MaxStale) {
+		c.hosts.Delete(ip.String())
+		return "", false
+	}
+	return entry.host, true
+}
+
+func (c *msgCache) clampTTL(ttl time.Duration) time.Duration {
+	if c.config.MinTTL > 0 && ttl < c.config.MinTTL {
+		ttl = c.config.MinTTL
+	}
+	if c.config.MaxTTL > 0 && ttl > c.config.MaxTTL {
+		ttl = c.config.MaxTTL
+	}
+	return ttl
+}
+
+// shouldPrefetch count a hit of entry and return true once it should be refreshed,
+// only one prefetch of an entry is started
+func (c *msgCache) shouldPrefetch(entry *cacheEntry) bool {
+	hits := atomic.AddUint32(&entry.hits, 1)
+	if !c.config.Prefetch || hits < prefetchHits {
+		return false
+	}
+
+	if entry.remaining() > entry.ttl/prefetchRatio {
+		return false
+	}
+	return atomic.CompareAndSwapInt32(&entry.prefetching, 0, 1)
+}
+
+func (c *msgCache) stats() CacheStats {
+	return CacheStats{
+		Size:     c.lru.Len(),
+		Hits:     atomic.LoadUint64(&c.hits),
+		Misses:   atomic.LoadUint64(&c.misses),
+		Stale:    atomic.LoadUint64(&c.stale),
+		Prefetch: atomic.LoadUint64(&c.prefetch),
+	}
+}
+
+func msgTTL(msg *D.Msg) (time.Duration, bool) {
+	var rr []D.RR
+	if len(msg.Answer) != 0 {
+		rr = msg.Answer
+	} else if len(msg.Ns) != 0 {
+		rr = msg.Ns
+	} else if len(msg.Extra) != 0 {
+		rr = msg.Extra
+	} else {
+		return 0, false
+	}
+	return time.Duration(rr[0].Header().Ttl) * time.Second, true
+}
+
+func newMsgCache(config CacheConfig) *msgCache {
+	if config.Size <= 0 {
+		config.Size = defaultCacheSize
+	}
+
+	return &msgCache{
+		config: config,
+		lru:    cache.NewLRUCache(cache.WithSize(config.Size)),
+		hosts:  cache.NewLRUCache(cache.WithSize(config.Size)),
+	}
+}
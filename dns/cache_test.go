@@ -0,0 +1,138 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolver_MappingApartFromCache(t *testing.T) {
+	main := newFakeClient(60, "10.0.0.1", "10.0.0.2", "10.0.0.3")
+	r := newTestResolver(Config{EnhancedMode: MAPPING, Cache: CacheConfig{Size: 2}}, main)
+
+	_, err := r.Exchange(query("a.example.com", D.TypeA))
+	assert.Nil(t, err)
+	_, err = r.Exchange(query("b.example.com", D.TypeA))
+	assert.Nil(t, err)
+
+	// the ips of the replies don't evict them nor count in the size
+	assert.Equal(t, 2, r.CacheStats().Size)
+	_, err = r.Exchange(query("a.example.com", D.TypeA))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, main.count())
+
+	// the latest reply of an ip wins
+	host, exist := r.IPToHost(net.IP{10, 0, 0, 3})
+	assert.True(t, exist)
+	assert.Equal(t, "b.example.com", host)
+
+	_, exist = r.IPToHost(net.IP{10, 0, 0, 4})
+	assert.False(t, exist)
+}
+
+// expire move the expiry of the cached reply of name by d
+func expire(r *Resolver, name string, qtype uint16, d time.Duration) {
+	item, _ := r.cache.lru.Get(query(name, qtype).Question[0].String())
+	entry := item.(*cacheEntry)
+	entry.expires = entry.expires.Add(-d)
+}
+
+// waitCount wait until client receives n queries
+func waitCount(t *testing.T, client *fakeClient, n int) {
+	for i := 0; i < 100 && client.count() < n; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, n, client.count())
+}
+
+func TestCache_ClampTTL(t *testing.T) {
+	for _, tt := range []struct {
+		ttl      uint32
+		min, max time.Duration
+		expected time.Duration
+	}{
+		{5, time.Minute, time.Hour, time.Minute},
+		{7200, time.Minute, time.Hour, time.Hour},
+		{600, time.Minute, time.Hour, 10 * time.Minute},
+		{5, 0, 0, 5 * time.Second},
+	} {
+		r := newTestResolver(Config{Cache: CacheConfig{MinTTL: tt.min, MaxTTL: tt.max}}, newFakeClient(tt.ttl, "10.0.0.1"))
+		_, err := r.Exchange(query("example.com", D.TypeA))
+		assert.Nil(t, err)
+
+		msg, err := r.Exchange(query("example.com", D.TypeA))
+		assert.Nil(t, err)
+		ttl := time.Duration(msg.Answer[0].Header().Ttl) * time.Second
+		assert.True(t, ttl <= tt.expected && ttl >= tt.expected-2*time.Second, "%d: %s", tt.ttl, ttl)
+		assert.Equal(t, uint64(1), r.CacheStats().Hits)
+	}
+}
+
+func TestCache_ServeStale(t *testing.T) {
+	main := newFakeClient(60, "10.0.0.1")
+	r := newTestResolver(Config{Cache: CacheConfig{ServeStale: true, MaxStale: time.Hour}}, main)
+	_, err := r.Exchange(query("example.com", D.TypeA))
+	assert.Nil(t, err)
+
+	// the expired reply is answered at once and refreshed in the background
+	expire(r, "example.com", D.TypeA, 2*time.Minute)
+	main.answers = []string{"10.0.0.2"}
+	msg, err := r.Exchange(query("example.com", D.TypeA))
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1", answerIP(msg))
+	assert.Equal(t, uint32(staleAnswerTTL), msg.Answer[0].Header().Ttl)
+	assert.Equal(t, uint64(1), r.CacheStats().Stale)
+	waitCount(t, main, 2)
+
+	msg, err = r.Exchange(query("example.com", D.TypeA))
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.2", answerIP(msg))
+
+	// beyond max-stale it is a miss
+	expire(r, "example.com", D.TypeA, 2*time.Hour)
+	_, err = r.Exchange(query("example.com", D.TypeA))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, main.count())
+	assert.Equal(t, uint64(1), r.CacheStats().Stale)
+
+	// without serve-stale too
+	r = newTestResolver(Config{}, main)
+	_, err = r.Exchange(query("example.com", D.TypeA))
+	assert.Nil(t, err)
+	expire(r, "example.com", D.TypeA, 2*time.Minute)
+	_, err = r.Exchange(query("example.com", D.TypeA))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, main.count())
+	assert.Equal(t, uint64(0), r.CacheStats().Stale)
+}
+
+func TestCache_Prefetch(t *testing.T) {
+	main := newFakeClient(600, "10.0.0.1")
+	r := newTestResolver(Config{Cache: CacheConfig{Prefetch: true}}, main)
+	_, err := r.Exchange(query("example.com", D.TypeA))
+	assert.Nil(t, err)
+
+	// not prefetched with plenty of ttl left
+	for i := 0; i < prefetchHits; i++ {
+		_, err = r.Exchange(query("example.com", D.TypeA))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, uint64(0), r.CacheStats().Prefetch)
+
+	// once less than 1/prefetchRatio of the ttl remains, it is prefetched once
+	expire(r, "example.com", D.TypeA, 595*time.Second)
+	for i := 0; i < 3; i++ {
+		_, err = r.Exchange(query("example.com", D.TypeA))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, uint64(1), r.CacheStats().Prefetch)
+	waitCount(t, main, 2)
+
+	// the entry is replaced by the refreshed reply
+	msg, err := r.Exchange(query("example.com", D.TypeA))
+	assert.Nil(t, err)
+	assert.True(t, msg.Answer[0].Header().Ttl > 590)
+}
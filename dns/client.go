@@ -2,6 +2,11 @@ package dns
 
 import (
 	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/ClashrAuto/Clashr/component/dialer"
+	C "github.com/ClashrAuto/Clashr/constant"
 
 	D "github.com/miekg/dns"
 )
@@ -9,6 +14,10 @@ import (
 type client struct {
 	*D.Client
 	Address string
+	// proxy is the outbound of the queries, nil means direct
+	proxy C.Proxy
+	// bootstrap resolve the hostname of Address, nil means the system resolver
+	bootstrap *Resolver
 }
 
 func (c *client) Exchange(m *D.Msg) (msg *D.Msg, err error) {
@@ -16,6 +25,97 @@ func (c *client) Exchange(m *D.Msg) (msg *D.Msg, err error) {
 }
 
 func (c *client) ExchangeContext(ctx context.Context, m *D.Msg) (msg *D.Msg, err error) {
-	msg, _, err = c.Client.ExchangeContext(ctx, m, c.Address)
+	// copy the client so the global socket options are picked up on every exchange
+	cl := *c.Client
+	network := cl.Net
+	if network == "" {
+		network = "udp"
+	} else if network == "tcp-tls" {
+		network = "tcp"
+	}
+	if c.proxy != nil {
+		return c.exchangeViaProxy(ctx, &cl, network, m)
+	}
+
+	address := c.Address
+	if host, _, _ := net.SplitHostPort(address); c.bootstrap != nil && net.ParseIP(host) == nil {
+		if address, err = resolveAddress(ctx, c.bootstrap, address); err != nil {
+			return nil, err
+		}
+
+		// verify the certificate with the hostname instead of the resolved ip
+		tlsConfig := cl.TLSConfig.Clone()
+		tlsConfig.ServerName = host
+		cl.TLSConfig = tlsConfig
+	}
+
+	cl.Dialer = dialer.Dialer(network, nil)
+	msg, _, err = cl.ExchangeContext(ctx, m, address)
 	return
 }
+
+func (c *client) exchangeViaProxy(ctx context.Context, cl *D.Client, network string, m *D.Msg) (*D.Msg, error) {
+	conn, err := dialProxy(ctx, c.proxy, network, c.Address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if cl.Net == "tcp-tls" {
+		host, _, _ := net.SplitHostPort(c.Address)
+		tlsConfig := cl.TLSConfig.Clone()
+		tlsConfig.ServerName = host
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	msg, _, err := cl.ExchangeWithConnContext(ctx, m, &D.Conn{Conn: conn})
+	return msg, err
+}
+
+type lookupResult struct {
+	ip  net.IP
+	err error
+}
+
+// resolveAddress replace the hostname of address with its ip resolved by bootstrap,
+// A and AAAA are queried together and A is preferred, it gives up once ctx is done
+func resolveAddress(ctx context.Context, bootstrap *Resolver, address string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return address, nil
+	}
+
+	v4, v6 := make(chan lookupResult, 1), make(chan lookupResult, 1)
+	go func() {
+		ip, err := bootstrap.ResolveIPv4(host)
+		v4 <- lookupResult{ip: ip, err: err}
+	}()
+	go func() {
+		ip, err := bootstrap.ResolveIPv6(host)
+		v6 <- lookupResult{ip: ip, err: err}
+	}()
+
+	var res lookupResult
+	for _, ch := range []chan lookupResult{v4, v6} {
+		select {
+		case res = <-ch:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		if res.err == nil {
+			return net.JoinHostPort(res.ip.String(), port), nil
+		}
+	}
+	return "", res.err
+}
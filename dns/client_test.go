@@ -0,0 +1,71 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveAddress(t *testing.T) {
+	dual := newFakeClient(60, "10.0.0.1", "fd00::1")
+	bootstrap := newTestResolver(Config{}, dual)
+
+	address, err := resolveAddress(context.Background(), bootstrap, "dns.example.com:853")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1:853", address)
+
+	// AAAA is used without A
+	v6 := newFakeClient(60, "fd00::1")
+	bootstrap = newTestResolver(Config{}, v6)
+	address, err = resolveAddress(context.Background(), bootstrap, "dns.example.com:853")
+	assert.Nil(t, err)
+	assert.Equal(t, "[fd00::1]:853", address)
+
+	address, err = resolveAddress(context.Background(), bootstrap, "10.0.0.2:53")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.2:53", address)
+}
+
+func TestResolveAddress_Context(t *testing.T) {
+	slow := newFakeClient(60, "10.0.0.1")
+	slow.wait = make(chan struct{})
+	defer close(slow.wait)
+	bootstrap := newTestResolver(Config{}, slow)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := resolveAddress(ctx, bootstrap, "dns.example.com:853")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+}
+
+func TestClient_Bootstrap(t *testing.T) {
+	address, stop := startUpstream(t, "10.0.0.1")
+	defer stop()
+	_, port, _ := net.SplitHostPort(address)
+
+	bootstrap := newTestResolver(Config{}, newFakeClient(60, "127.0.0.1"))
+	clients := transform([]NameServer{
+		{Addr: net.JoinHostPort("dns.example.com", port)},
+		{Net: "tcp", Addr: net.JoinHostPort("dns.example.com", port)},
+	}, bootstrap)
+
+	for _, client := range clients {
+		msg, err := client.Exchange(query("example.com", D.TypeA))
+		if assert.Nil(t, err) {
+			assert.Equal(t, "10.0.0.1", answerIP(msg))
+		}
+	}
+
+	// the hostname fails to resolve
+	bootstrap = newTestResolver(Config{}, &fakeClient{err: errFakeClient})
+	clients = transform([]NameServer{{Addr: net.JoinHostPort("dns.example.com", port)}}, bootstrap)
+	_, err := clients[0].Exchange(query("example.com", D.TypeA))
+	assert.Error(t, err)
+}
@@ -5,8 +5,12 @@ import (
 	"context"
 	"crypto/tls"
 	"io/ioutil"
+	"net"
 	"net/http"
 
+	"github.com/ClashrAuto/Clashr/component/dialer"
+	C "github.com/ClashrAuto/Clashr/constant"
+
 	D "github.com/miekg/dns"
 )
 
@@ -20,10 +24,44 @@ const (
 
 var dohTransport = &http.Transport{
 	TLSClientConfig: &tls.Config{ClientSessionCache: globalSessionCache},
+	DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr, nil)
+	},
 }
 
 type dohClient struct {
-	url string
+	url       string
+	transport *http.Transport
+}
+
+// newDoHClient return the DoH client of url, the requests are sent through proxy if it is not nil,
+// otherwise the hostname of url is resolved by bootstrap if it is not nil
+func newDoHClient(url string, proxy C.Proxy, bootstrap *Resolver) *dohClient {
+	var dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	switch {
+	case proxy != nil:
+		dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialProxy(ctx, proxy, "tcp", addr)
+		}
+	case bootstrap != nil:
+		dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			addr, err := resolveAddress(ctx, bootstrap, addr)
+			if err != nil {
+				return nil, err
+			}
+			return dialer.DialContext(ctx, network, addr, nil)
+		}
+	default:
+		return &dohClient{url: url, transport: dohTransport}
+	}
+
+	return &dohClient{
+		url: url,
+		transport: &http.Transport{
+			TLSClientConfig: &tls.Config{ClientSessionCache: globalSessionCache},
+			DialContext:     dial,
+		},
+	}
 }
 
 func (dc *dohClient) Exchange(m *D.Msg) (msg *D.Msg, err error) {
@@ -58,7 +96,7 @@ func (dc *dohClient) newRequest(m *D.Msg) (*http.Request, error) {
 }
 
 func (dc *dohClient) doRequest(req *http.Request) (msg *D.Msg, err error) {
-	client := &http.Client{Transport: dohTransport}
+	client := &http.Client{Transport: dc.transport}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
@@ -24,3 +24,17 @@ type ipnetFilter struct {
 func (inf *ipnetFilter) Match(ip net.IP) bool {
 	return inf.ipnet.Contains(ip)
 }
+
+// ipnetInvertFilter match the ips outside all the subnets, so that only the answers in them use fallback
+type ipnetInvertFilter struct {
+	ipnets []*net.IPNet
+}
+
+func (iif *ipnetInvertFilter) Match(ip net.IP) bool {
+	for _, ipnet := range iif.ipnets {
+		if ipnet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
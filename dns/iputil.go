@@ -13,22 +13,31 @@ var (
 
 // ResolveIPv4 with a host, return ipv4
 func ResolveIPv4(host string) (net.IP, error) {
+	ips, err := ResolveAllIPv4(host)
+	if err != nil {
+		return nil, err
+	}
+	return ips[0], nil
+}
+
+// ResolveAllIPv4 with a host, return all the ipv4 addresses
+func ResolveAllIPv4(host string) ([]net.IP, error) {
 	if node := DefaultHosts.Search(host); node != nil {
 		if ip := node.Data.(net.IP).To4(); ip != nil {
-			return ip, nil
+			return []net.IP{ip}, nil
 		}
 	}
 
 	ip := net.ParseIP(host)
 	if ip != nil {
 		if !strings.Contains(host, ":") {
-			return ip, nil
+			return []net.IP{ip}, nil
 		}
 		return nil, errIPVersion
 	}
 
 	if DefaultResolver != nil {
-		return DefaultResolver.ResolveIPv4(host)
+		return DefaultResolver.ResolveAllIPv4(host)
 	}
 
 	ipAddrs, err := net.LookupIP(host)
@@ -36,33 +45,45 @@ func ResolveIPv4(host string) (net.IP, error) {
 		return nil, err
 	}
 
+	ips := []net.IP{}
 	for _, ip := range ipAddrs {
 		if ip4 := ip.To4(); ip4 != nil {
-			return ip4, nil
+			ips = append(ips, ip4)
 		}
 	}
-
-	return nil, errIPNotFound
+	if len(ips) == 0 {
+		return nil, errIPNotFound
+	}
+	return ips, nil
 }
 
 // ResolveIPv6 with a host, return ipv6
 func ResolveIPv6(host string) (net.IP, error) {
+	ips, err := ResolveAllIPv6(host)
+	if err != nil {
+		return nil, err
+	}
+	return ips[0], nil
+}
+
+// ResolveAllIPv6 with a host, return all the ipv6 addresses
+func ResolveAllIPv6(host string) ([]net.IP, error) {
 	if node := DefaultHosts.Search(host); node != nil {
 		if ip := node.Data.(net.IP).To16(); ip != nil {
-			return ip, nil
+			return []net.IP{ip}, nil
 		}
 	}
 
 	ip := net.ParseIP(host)
 	if ip != nil {
 		if strings.Contains(host, ":") {
-			return ip, nil
+			return []net.IP{ip}, nil
 		}
 		return nil, errIPVersion
 	}
 
 	if DefaultResolver != nil {
-		return DefaultResolver.ResolveIPv6(host)
+		return DefaultResolver.ResolveAllIPv6(host)
 	}
 
 	ipAddrs, err := net.LookupIP(host)
@@ -70,13 +91,16 @@ func ResolveIPv6(host string) (net.IP, error) {
 		return nil, err
 	}
 
+	ips := []net.IP{}
 	for _, ip := range ipAddrs {
 		if ip.To4() == nil {
-			return ip, nil
+			ips = append(ips, ip)
 		}
 	}
-
-	return nil, errIPNotFound
+	if len(ips) == 0 {
+		return nil, errIPNotFound
+	}
+	return ips, nil
 }
 
 // ResolveIP with a host, return ip
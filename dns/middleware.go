@@ -1,8 +1,10 @@
 package dns
 
 import (
+	"net"
 	"strings"
 
+	trie "github.com/ClashrAuto/Clashr/component/domain-trie"
 	"github.com/ClashrAuto/Clashr/component/fakeip"
 	"github.com/ClashrAuto/Clashr/log"
 
@@ -12,25 +14,57 @@ import (
 type handler func(w D.ResponseWriter, r *D.Msg)
 type middleware func(next handler) handler
 
-func withFakeIP(fakePool *fakeip.Pool) middleware {
+func withBlocker(blocker *Blocker) middleware {
+	return func(next handler) handler {
+		return func(w D.ResponseWriter, r *D.Msg) {
+			// the names of the lists are lowercased when loaded
+			host := strings.ToLower(strings.TrimRight(r.Question[0].Name, "."))
+			list := blocker.Match(host)
+			if list == nil {
+				next(w, r)
+				return
+			}
+
+			log.Debugln("[DNS Server] %s blocked by %s", host, list.Name)
+			_ = w.WriteMsg(blocker.block(list, r))
+			return
+		}
+	}
+}
+
+func withFakeIP(fakePool, fakePool6 *fakeip.Pool, filter *trie.Trie) middleware {
 	return func(next handler) handler {
 		return func(w D.ResponseWriter, r *D.Msg) {
 			q := r.Question[0]
+			host := strings.TrimRight(q.Name, ".")
 
-			if q.Qtype == D.TypeAAAA {
-				D.HandleFailed(w, r)
-				return
-			} else if q.Qtype != D.TypeA {
+			// the domains in fake-ip-filter get the real answers
+			if filter != nil && filter.Search(host) != nil {
 				next(w, r)
 				return
 			}
 
-			host := strings.TrimRight(q.Name, ".")
+			var rr D.RR
+			switch q.Qtype {
+			case D.TypeA:
+				rr = &D.A{
+					Hdr: D.RR_Header{Name: q.Name, Rrtype: D.TypeA, Class: D.ClassINET, Ttl: dnsDefaultTTL},
+					A:   fakePool.Lookup(host),
+				}
+			case D.TypeAAAA:
+				if fakePool6 == nil {
+					D.HandleFailed(w, r)
+					return
+				}
+				rr = &D.AAAA{
+					Hdr:  D.RR_Header{Name: q.Name, Rrtype: D.TypeAAAA, Class: D.ClassINET, Ttl: dnsDefaultTTL},
+					AAAA: fakePool6.Lookup(host),
+				}
+			default:
+				next(w, r)
+				return
+			}
 
-			rr := &D.A{}
-			rr.Hdr = D.RR_Header{Name: q.Name, Rrtype: D.TypeA, Class: D.ClassINET, Ttl: dnsDefaultTTL}
-			ip := fakePool.Lookup(host)
-			rr.A = ip
 			msg := r.Copy()
 			msg.Answer = []D.RR{rr}
 
@@ -51,12 +85,26 @@ func withResolver(resolver *Resolver) handler {
 			D.HandleFailed(w, r)
 			return
 		}
+		// the reply may be shared by the concurrent queries of singleflight
+		msg = msg.Copy()
 		msg.SetReply(r)
+		// truncate the large replies over udp, so that the client retries over tcp
+		if _, ok := w.LocalAddr().(*net.UDPAddr); ok {
+			msg.Truncate(udpSize(r))
+		}
 		_ = w.WriteMsg(msg)
 		return
 	}
 }
 
+// udpSize return the max size of the udp reply the client accepts
+func udpSize(r *D.Msg) int {
+	if opt := r.IsEdns0(); opt != nil && opt.UDPSize() > D.MinMsgSize {
+		return int(opt.UDPSize())
+	}
+	return D.MinMsgSize
+}
+
 func compose(middlewares []middleware, endpoint handler) handler {
 	length := len(middlewares)
 	h := endpoint
@@ -70,8 +118,12 @@ func compose(middlewares []middleware, endpoint handler) handler {
 func newHandler(resolver *Resolver) handler {
 	middlewares := []middleware{}
 
+	if resolver.blocker != nil {
+		middlewares = append(middlewares, withBlocker(resolver.blocker))
+	}
+
 	if resolver.IsFakeIP() {
-		middlewares = append(middlewares, withFakeIP(resolver.pool))
+		middlewares = append(middlewares, withFakeIP(resolver.pool, resolver.pool6, resolver.fakeIPFilter))
 	}
 
 	return compose(middlewares, withResolver(resolver))
@@ -0,0 +1,123 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	trie "github.com/ClashrAuto/Clashr/component/domain-trie"
+	"github.com/ClashrAuto/Clashr/component/fakeip"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordWriter collect the reply written to a client at local
+type recordWriter struct {
+	local net.Addr
+	msg   *D.Msg
+}
+
+func (w *recordWriter) LocalAddr() net.Addr         { return w.local }
+func (w *recordWriter) RemoteAddr() net.Addr        { return w.local }
+func (w *recordWriter) WriteMsg(msg *D.Msg) error   { w.msg = msg; return nil }
+func (w *recordWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *recordWriter) Close() error                { return nil }
+func (w *recordWriter) TsigStatus() error           { return nil }
+func (w *recordWriter) TsigTimersOnly(bool)         {}
+func (w *recordWriter) Hijack()                     {}
+
+func TestHandler_TruncateSharedReply(t *testing.T) {
+	answers := []string{}
+	for i := 0; i < 64; i++ {
+		answers = append(answers, fmt.Sprintf("10.0.0.%d", i))
+	}
+	main := newFakeClient(60, answers...)
+	main.wait = make(chan struct{})
+	h := newHandler(newTestResolver(Config{}, main))
+
+	udp := &recordWriter{local: &net.UDPAddr{}}
+	tcp := &recordWriter{local: &net.TCPAddr{}}
+	wg := sync.WaitGroup{}
+	for _, w := range []*recordWriter{udp, tcp} {
+		wg.Add(1)
+		go func(w *recordWriter) {
+			defer wg.Done()
+			h(w, query("example.com", D.TypeA))
+		}(w)
+	}
+
+	// both queries wait for the same exchange
+	time.Sleep(50 * time.Millisecond)
+	close(main.wait)
+	wg.Wait()
+
+	assert.True(t, udp.msg.Truncated)
+	assert.True(t, udp.msg.Len() <= D.MinMsgSize)
+	assert.False(t, tcp.msg.Truncated)
+	assert.Len(t, tcp.msg.Answer, len(answers))
+}
+
+func newTestPool(t *testing.T, cidr string) *fakeip.Pool {
+	_, ipnet, _ := net.ParseCIDR(cidr)
+	pool, err := fakeip.New(ipnet, 100)
+	assert.Nil(t, err)
+	return pool
+}
+
+func TestHandler_FakeIPFilter(t *testing.T) {
+	filter := trie.New()
+	filter.Insert("+.lan", struct{}{})
+	pool := newTestPool(t, "198.18.0.1/16")
+	main := newFakeClient(60, "10.0.0.1")
+	r := newTestResolver(Config{EnhancedMode: FAKEIP, Pool: pool, FakeIPFilter: filter}, main)
+	h := newHandler(r)
+
+	w := &recordWriter{local: &net.UDPAddr{}}
+	h(w, query("example.com", D.TypeA))
+	fake := net.ParseIP(answerIP(w.msg))
+	assert.True(t, pool.Contains(fake))
+	assert.Equal(t, uint32(1), w.msg.Answer[0].Header().Ttl)
+	assert.Equal(t, 0, main.count())
+
+	// the domains of the filter get the real answers, mapped back to them
+	w = &recordWriter{local: &net.UDPAddr{}}
+	h(w, query("nas.lan", D.TypeA))
+	assert.Equal(t, "10.0.0.1", answerIP(w.msg))
+	assert.Equal(t, 1, main.count())
+
+	host, exist := r.IPToHost(net.IP{10, 0, 0, 1})
+	assert.True(t, exist)
+	assert.Equal(t, "nas.lan", host)
+	host, exist = r.IPToHost(fake)
+	assert.True(t, exist)
+	assert.Equal(t, "example.com", host)
+}
+
+func TestHandler_FakeIPv6(t *testing.T) {
+	pool := newTestPool(t, "198.18.0.1/16")
+	pool6 := newTestPool(t, "fdfe:dcba:9876::1/64")
+	r := newTestResolver(Config{EnhancedMode: FAKEIP, Pool: pool, Pool6: pool6}, newFakeClient(60, "fd00::1"))
+	h := newHandler(r)
+
+	w := &recordWriter{local: &net.UDPAddr{}}
+	h(w, query("example.com", D.TypeAAAA))
+	if assert.Len(t, w.msg.Answer, 1) {
+		fake := w.msg.Answer[0].(*D.AAAA).AAAA
+		assert.True(t, pool6.Contains(fake))
+		assert.True(t, r.IsFakeIPAddr(fake))
+
+		host, exist := r.IPToHost(fake)
+		assert.True(t, exist)
+		assert.Equal(t, "example.com", host)
+	}
+
+	// AAAA fails without the IPv6 range
+	h = newHandler(newTestResolver(Config{EnhancedMode: FAKEIP, Pool: pool}, newFakeClient(60, "fd00::1")))
+	w = &recordWriter{local: &net.UDPAddr{}}
+	h(w, query("example.com", D.TypeAAAA))
+	assert.Equal(t, D.RcodeServerFailure, w.msg.Rcode)
+	assert.Empty(t, w.msg.Answer)
+}
@@ -0,0 +1,72 @@
+package dns
+
+import (
+	"context"
+	"net"
+
+	C "github.com/ClashrAuto/Clashr/constant"
+)
+
+// packetConn is the udp of a proxy as a connected net.Conn, so that it can be used by D.Conn
+type packetConn struct {
+	C.PacketConn
+	remote net.Addr
+}
+
+func (pc *packetConn) Read(b []byte) (int, error) {
+	n, _, err := pc.ReadFrom(b)
+	return n, err
+}
+
+func (pc *packetConn) Write(b []byte) (int, error) {
+	return pc.WriteTo(b, pc.remote)
+}
+
+func (pc *packetConn) RemoteAddr() net.Addr {
+	return pc.remote
+}
+
+// dialProxy connect to address through proxy, network is udp or tcp
+func dialProxy(ctx context.Context, proxy C.Proxy, network, address string) (net.Conn, error) {
+	metadata, err := addrToMetadata(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if network != "udp" {
+		return proxy.DialContext(ctx, metadata)
+	}
+
+	pc, remote, err := proxy.DialUDP(metadata)
+	if err != nil {
+		return nil, err
+	}
+	return &packetConn{PacketConn: pc, remote: remote}, nil
+}
+
+func addrToMetadata(network, address string) (*C.Metadata, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &C.Metadata{
+		NetWork:  C.TCP,
+		Host:     host,
+		DstPort:  port,
+		AddrType: C.AtypDomainName,
+	}
+	if network == "udp" {
+		metadata.NetWork = C.UDP
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		metadata.Host = ""
+		metadata.DstIP = &ip
+		metadata.AddrType = C.AtypIPv6
+		if ip.To4() != nil {
+			metadata.AddrType = C.AtypIPv4
+		}
+	}
+	return metadata, nil
+}
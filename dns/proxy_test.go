@@ -0,0 +1,127 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	C "github.com/ClashrAuto/Clashr/constant"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+type chainConn struct{ net.Conn }
+
+func (c *chainConn) Chains() C.Chain               { return nil }
+func (c *chainConn) AppendToChains(C.ProxyAdapter) {}
+
+type chainPacketConn struct{ net.PacketConn }
+
+func (pc *chainPacketConn) Chains() C.Chain               { return nil }
+func (pc *chainPacketConn) AppendToChains(C.ProxyAdapter) {}
+
+// fakeProxy is a C.Proxy connecting directly, it records the destinations
+type fakeProxy struct {
+	C.Proxy
+	mux  sync.Mutex
+	dest []string
+}
+
+func (p *fakeProxy) record(metadata *C.Metadata) string {
+	address := net.JoinHostPort(metadata.DstIP.String(), metadata.DstPort)
+	p.mux.Lock()
+	p.dest = append(p.dest, metadata.NetWork.String()+"://"+address)
+	p.mux.Unlock()
+	return address
+}
+
+func (p *fakeProxy) DialContext(ctx context.Context, metadata *C.Metadata) (C.Conn, error) {
+	c, err := (&net.Dialer{}).DialContext(ctx, "tcp", p.record(metadata))
+	if err != nil {
+		return nil, err
+	}
+	return &chainConn{c}, nil
+}
+
+func (p *fakeProxy) DialUDP(metadata *C.Metadata) (C.PacketConn, net.Addr, error) {
+	remote, err := net.ResolveUDPAddr("udp", p.record(metadata))
+	if err != nil {
+		return nil, nil, err
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, nil, err
+	}
+	return &chainPacketConn{pc}, remote, nil
+}
+
+func (p *fakeProxy) destinations() []string {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return append([]string{}, p.dest...)
+}
+
+// startUpstream serve udp and tcp at the same port of 127.0.0.1, answering the A queries with ip
+func startUpstream(t *testing.T, ip string) (string, func()) {
+	handler := D.HandlerFunc(func(w D.ResponseWriter, r *D.Msg) {
+		_ = w.WriteMsg(newFakeClient(60, ip).reply(r))
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	p, err := net.ListenPacket("udp", l.Addr().String())
+	assert.Nil(t, err)
+
+	udp := &D.Server{PacketConn: p, Handler: handler}
+	tcp := &D.Server{Listener: l, Handler: handler}
+	for _, s := range []*D.Server{udp, tcp} {
+		started := make(chan struct{})
+		s.NotifyStartedFunc = func() { close(started) }
+		go s.ActivateAndServe()
+		<-started
+	}
+	return l.Addr().String(), func() {
+		udp.Shutdown()
+		tcp.Shutdown()
+	}
+}
+
+func TestClient_ExchangeViaProxy(t *testing.T) {
+	address, stop := startUpstream(t, "10.0.0.1")
+	defer stop()
+
+	proxy := &fakeProxy{}
+	clients := transform([]NameServer{
+		{Addr: address, Proxy: proxy},
+		{Net: "tcp", Addr: address, Proxy: proxy},
+	}, nil)
+
+	for _, client := range clients {
+		msg, err := client.Exchange(query("example.com", D.TypeA))
+		if assert.Nil(t, err) {
+			assert.Equal(t, "10.0.0.1", answerIP(msg))
+		}
+	}
+	assert.Equal(t, []string{"udp://" + address, "tcp://" + address}, proxy.destinations())
+}
+
+func TestResolver_ProxyServers(t *testing.T) {
+	main := newFakeClient(60, "10.0.0.1")
+	direct := newFakeClient(60, "10.0.0.2")
+	r := newTestResolver(Config{}, main)
+	r.direct = []resolver{direct}
+	r.proxyServers = map[string]bool{"ss.example.com": true}
+
+	// the servers of the proxies used by the nameservers are resolved without them
+	ip, err := r.ResolveIPv4("ss.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.2", ip.String())
+
+	ip, err = r.ResolveIPv4("example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1", ip.String())
+	assert.Equal(t, 1, main.count())
+	assert.Equal(t, 1, direct.count())
+}
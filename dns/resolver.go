@@ -7,13 +7,14 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/ClashrAuto/Clashr/common/cache"
 	"github.com/ClashrAuto/Clashr/common/picker"
 	trie "github.com/ClashrAuto/Clashr/component/domain-trie"
 	"github.com/ClashrAuto/Clashr/component/fakeip"
 	C "github.com/ClashrAuto/Clashr/constant"
+	"github.com/ClashrAuto/Clashr/log"
 
 	D "github.com/miekg/dns"
 	geoip2 "github.com/oschwald/geoip2-golang"
@@ -50,11 +51,18 @@ type Resolver struct {
 	mapping         bool
 	fakeip          bool
 	pool            *fakeip.Pool
+	pool6           *fakeip.Pool
+	fakeIPFilter    *trie.Trie
+	blocker         *Blocker
 	main            []resolver
 	fallback        []resolver
+	direct          []resolver
+	proxyServers    map[string]bool
 	fallbackFilters []fallbackFilter
+	fallbackDomains *trie.Trie
+	policy          *trie.Trie
 	group           singleflight.Group
-	cache           *cache.Cache
+	cache           *msgCache
 }
 
 // ResolveIP request with TypeA and TypeAAAA, priority return TypeAAAA
@@ -95,6 +103,16 @@ func (r *Resolver) ResolveIPv6(host string) (ip net.IP, err error) {
 	return r.resolveIP(host, D.TypeAAAA)
 }
 
+// ResolveAllIPv4 request with TypeA, return all the addresses of the answer
+func (r *Resolver) ResolveAllIPv4(host string) ([]net.IP, error) {
+	return r.resolveAllIP(host, D.TypeA)
+}
+
+// ResolveAllIPv6 request with TypeAAAA, return all the addresses of the answer
+func (r *Resolver) ResolveAllIPv6(host string) ([]net.IP, error) {
+	return r.resolveAllIP(host, D.TypeAAAA)
+}
+
 func (r *Resolver) shouldFallback(ip net.IP) bool {
 	for _, filter := range r.fallbackFilters {
 		if filter.Match(ip) {
@@ -111,27 +129,67 @@ func (r *Resolver) Exchange(m *D.Msg) (msg *D.Msg, err error) {
 	}
 
 	q := m.Question[0]
-	cache, expireTime := r.cache.GetWithExpire(q.String())
-	if cache != nil {
-		msg = cache.(*D.Msg).Copy()
-		setMsgTTL(msg, uint32(expireTime.Sub(time.Now()).Seconds()))
+	key := q.String()
+	if entry, stale := r.cache.get(key); entry != nil {
+		msg = entry.msg.Copy()
+		if stale {
+			// RFC 8767, answer the expired entry and refresh it in the background
+			atomic.AddUint64(&r.cache.stale, 1)
+			setMsgTTL(msg, staleAnswerTTL)
+			go r.refresh(m.Copy())
+			return
+		}
+
+		atomic.AddUint64(&r.cache.hits, 1)
+		setMsgTTL(msg, uint32(entry.remaining().Seconds()))
+		if r.cache.shouldPrefetch(entry) {
+			atomic.AddUint64(&r.cache.prefetch, 1)
+			go r.refresh(m.Copy())
+		}
 		return
 	}
+
+	atomic.AddUint64(&r.cache.misses, 1)
+	return r.exchangeWithoutCache(m)
+}
+
+// refresh exchange m again to update the cache
+func (r *Resolver) refresh(m *D.Msg) {
+	if _, err := r.exchangeWithoutCache(m); err != nil {
+		log.Debugln("[DNS] refresh %s failed: %v", m.Question[0].String(), err)
+	}
+}
+
+// exchangeWithoutCache exchange m with the nameservers and put the reply to the cache
+func (r *Resolver) exchangeWithoutCache(m *D.Msg) (msg *D.Msg, err error) {
+	q := m.Question[0]
 	defer func() {
 		if msg == nil {
 			return
 		}
 
-		putMsgToCache(r.cache, q.String(), msg)
-		if r.mapping {
-			ips := r.msgToIP(msg)
-			for _, ip := range ips {
-				putMsgToCache(r.cache, ip.String(), msg)
-			}
+		r.cache.put(q.String(), msg)
+		// in fake-ip mode, the real ips of fake-ip-filter are mapped back to their hosts as well
+		if r.mapping || r.fakeip {
+			r.cache.putHosts(msg, r.msgToIP(msg))
 		}
 	}()
 
 	ret, err, _ := r.group.Do(q.String(), func() (interface{}, error) {
+		// the servers of the proxies used by nameservers are resolved directly to avoid the loop
+		if r.proxyServers[strings.TrimRight(q.Name, ".")] {
+			return r.batchExchange(r.direct, m)
+		}
+
+		if clients := r.matchPolicy(q); clients != nil {
+			return r.batchExchange(clients, m)
+		}
+
+		// the answers of main are not trusted for the domains of fallback-filter
+		if r.fallbackDomains != nil && r.fallbackDomains.Search(strings.TrimRight(q.Name, ".")) != nil {
+			return r.batchExchange(r.fallback, m)
+		}
+
 		isIPReq := isIPRequest(q)
 		if isIPReq {
 			msg, err := r.fallbackExchange(m)
@@ -148,18 +206,36 @@ func (r *Resolver) Exchange(m *D.Msg) (msg *D.Msg, err error) {
 	return
 }
 
+// CacheStats return the counters of the cache
+func (r *Resolver) CacheStats() CacheStats {
+	return r.cache.stats()
+}
+
+// Blocker return the block lists of the dns server, nil if there is none
+func (r *Resolver) Blocker() *Blocker {
+	return r.blocker
+}
+
+// matchPolicy return the nameservers of nameserver-policy for the question, nil if none matches
+func (r *Resolver) matchPolicy(q D.Question) []resolver {
+	if r.policy == nil {
+		return nil
+	}
+
+	domain := strings.TrimRight(q.Name, ".")
+	if node := r.policy.Search(domain); node != nil {
+		return node.Data.([]resolver)
+	}
+	return nil
+}
+
 // IPToHost return fake-ip or redir-host mapping host
 func (r *Resolver) IPToHost(ip net.IP) (string, bool) {
-	if r.fakeip {
-		return r.pool.LookBack(ip)
+	if pool := r.fakePoolOf(ip); pool != nil {
+		return pool.LookBack(ip)
 	}
 
-	cache := r.cache.Get(ip.String())
-	if cache == nil {
-		return "", false
-	}
-	fqdn := cache.(*D.Msg).Question[0].Name
-	return strings.TrimRight(fqdn, "."), true
+	return r.cache.getHost(ip)
 }
 
 func (r *Resolver) IsMapping() bool {
@@ -170,6 +246,25 @@ func (r *Resolver) IsFakeIP() bool {
 	return r.fakeip
 }
 
+// IsFakeIPAddr return whether ip is allocated from the fake-ip pools
+func (r *Resolver) IsFakeIPAddr(ip net.IP) bool {
+	return r.fakePoolOf(ip) != nil
+}
+
+// fakePoolOf return the fake-ip pool whose range contains ip
+func (r *Resolver) fakePoolOf(ip net.IP) *fakeip.Pool {
+	if !r.fakeip {
+		return nil
+	}
+
+	for _, pool := range []*fakeip.Pool{r.pool, r.pool6} {
+		if pool != nil && pool.Contains(ip) {
+			return pool
+		}
+	}
+	return nil
+}
+
 func (r *Resolver) batchExchange(clients []resolver, m *D.Msg) (msg *D.Msg, err error) {
 	fast, ctx := picker.WithTimeout(context.Background(), time.Second)
 	for _, client := range clients {
@@ -217,13 +312,21 @@ func (r *Resolver) fallbackExchange(m *D.Msg) (msg *D.Msg, err error) {
 }
 
 func (r *Resolver) resolveIP(host string, dnsType uint16) (ip net.IP, err error) {
-	ip = net.ParseIP(host)
+	ips, err := r.resolveAllIP(host, dnsType)
+	if err != nil {
+		return nil, err
+	}
+	return ips[0], nil
+}
+
+func (r *Resolver) resolveAllIP(host string, dnsType uint16) ([]net.IP, error) {
+	ip := net.ParseIP(host)
 	if ip != nil {
 		isIPv4 := ip.To4() != nil
 		if dnsType == D.TypeAAAA && !isIPv4 {
-			return ip, nil
+			return []net.IP{ip}, nil
 		} else if dnsType == D.TypeA && isIPv4 {
-			return ip, nil
+			return []net.IP{ip}, nil
 		}
 	}
 
@@ -239,9 +342,7 @@ func (r *Resolver) resolveIP(host string, dnsType uint16) (ip net.IP, err error)
 	if len(ips) == 0 {
 		return nil, errIPNotFound
 	}
-
-	ip = ips[0]
-	return
+	return ips, nil
 }
 
 func (r *Resolver) msgToIP(msg *D.Msg) []net.IP {
@@ -271,33 +372,85 @@ func (r *Resolver) asyncExchange(client []resolver, msg *D.Msg) <-chan *result {
 type NameServer struct {
 	Net  string
 	Addr string
+	// Proxy is the outbound of the queries, nil means direct
+	Proxy C.Proxy
 }
 
 type FallbackFilter struct {
 	GeoIP  bool
 	IPCIDR []*net.IPNet
+	// IPCIDRInvert accept the answers of Main outside IPCIDR instead of inside,
+	// so that the answers in IPCIDR use Fallback
+	IPCIDRInvert bool
+	// Domain is the domains always resolved by Fallback, it supports the patterns of the domain trie
+	Domain []string
 }
 
 type Config struct {
 	Main, Fallback []NameServer
+	// Default is the plain nameservers with ip which resolve the hostnames of the other nameservers
+	Default []NameServer
+	// Policy is the nameservers of domains instead of Main and Fallback,
+	// the keys support the patterns of the domain trie
+	Policy         map[string][]NameServer
 	IPv6           bool
 	EnhancedMode   EnhancedMode
 	FallbackFilter FallbackFilter
 	Pool           *fakeip.Pool
+	// Pool6 answer the AAAA queries in fake-ip mode (optional)
+	Pool6 *fakeip.Pool
+	Cache CacheConfig
+	// ProxyServers is the hostnames resolved only by the Main nameservers without proxy
+	ProxyServers []string
+	// FakeIPFilter is the domains resolved normally in fake-ip mode
+	FakeIPFilter *trie.Trie
+	// Blocker answer the blocked domains in the dns server (optional)
+	Blocker *Blocker
 }
 
 func New(config Config) *Resolver {
+	// the hostnames of the nameservers are resolved by the default nameservers, not the system resolver
+	var bootstrap *Resolver
+	if len(config.Default) != 0 {
+		bootstrap = New(Config{Main: config.Default})
+	}
+
 	r := &Resolver{
-		ipv6:    config.IPv6,
-		main:    transform(config.Main),
-		cache:   cache.New(time.Second * 60),
-		mapping: config.EnhancedMode == MAPPING,
-		fakeip:  config.EnhancedMode == FAKEIP,
-		pool:    config.Pool,
+		ipv6:         config.IPv6,
+		main:         transform(config.Main, bootstrap),
+		cache:        newMsgCache(config.Cache),
+		mapping:      config.EnhancedMode == MAPPING,
+		fakeip:       config.EnhancedMode == FAKEIP,
+		pool:         config.Pool,
+		pool6:        config.Pool6,
+		fakeIPFilter: config.FakeIPFilter,
+		blocker:      config.Blocker,
 	}
 
 	if len(config.Fallback) != 0 {
-		r.fallback = transform(config.Fallback)
+		r.fallback = transform(config.Fallback, bootstrap)
+	}
+
+	if len(config.ProxyServers) != 0 {
+		direct := []NameServer{}
+		for _, ns := range config.Main {
+			if ns.Proxy == nil {
+				direct = append(direct, ns)
+			}
+		}
+		r.direct = transform(direct, bootstrap)
+
+		r.proxyServers = map[string]bool{}
+		for _, host := range config.ProxyServers {
+			r.proxyServers[host] = true
+		}
+	}
+
+	if len(config.Policy) != 0 {
+		r.policy = trie.New()
+		for domain, nameservers := range config.Policy {
+			r.policy.Insert(domain, transform(nameservers, bootstrap))
+		}
 	}
 
 	fallbackFilters := []fallbackFilter{}
@@ -308,10 +461,23 @@ func New(config Config) *Resolver {
 
 		fallbackFilters = append(fallbackFilters, &geoipFilter{})
 	}
-	for _, ipnet := range config.FallbackFilter.IPCIDR {
-		fallbackFilters = append(fallbackFilters, &ipnetFilter{ipnet: ipnet})
+	if config.FallbackFilter.IPCIDRInvert {
+		if len(config.FallbackFilter.IPCIDR) != 0 {
+			fallbackFilters = append(fallbackFilters, &ipnetInvertFilter{ipnets: config.FallbackFilter.IPCIDR})
+		}
+	} else {
+		for _, ipnet := range config.FallbackFilter.IPCIDR {
+			fallbackFilters = append(fallbackFilters, &ipnetFilter{ipnet: ipnet})
+		}
 	}
 	r.fallbackFilters = fallbackFilters
 
+	if len(config.FallbackFilter.Domain) != 0 && r.fallback != nil {
+		r.fallbackDomains = trie.New()
+		for _, domain := range config.FallbackFilter.Domain {
+			r.fallbackDomains.Insert(domain, struct{}{})
+		}
+	}
+
 	return r
 }
@@ -0,0 +1,195 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	trie "github.com/ClashrAuto/Clashr/component/domain-trie"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClient answer the queries with the ips of answers, or fail if err is set
+type fakeClient struct {
+	answers []string
+	ttl     uint32
+	err     error
+	// wait block the queries until it is closed, nil means no wait
+	wait    chan struct{}
+	queries int32
+}
+
+func (c *fakeClient) Exchange(m *D.Msg) (*D.Msg, error) {
+	return c.ExchangeContext(context.Background(), m)
+}
+
+func (c *fakeClient) ExchangeContext(ctx context.Context, m *D.Msg) (*D.Msg, error) {
+	atomic.AddInt32(&c.queries, 1)
+	if c.wait != nil {
+		select {
+		case <-c.wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.reply(m), nil
+}
+
+// reply answer m with the ips of answers in its family
+func (c *fakeClient) reply(m *D.Msg) *D.Msg {
+	q := m.Question[0]
+	msg := &D.Msg{}
+	msg.SetReply(m)
+	for _, answer := range c.answers {
+		ip := net.ParseIP(answer)
+		hdr := D.RR_Header{Name: q.Name, Class: D.ClassINET, Ttl: c.ttl}
+		if ip.To4() != nil && q.Qtype == D.TypeA {
+			hdr.Rrtype = D.TypeA
+			msg.Answer = append(msg.Answer, &D.A{Hdr: hdr, A: ip})
+		} else if ip.To4() == nil && q.Qtype == D.TypeAAAA {
+			hdr.Rrtype = D.TypeAAAA
+			msg.Answer = append(msg.Answer, &D.AAAA{Hdr: hdr, AAAA: ip})
+		}
+	}
+	return msg
+}
+
+func (c *fakeClient) count() int {
+	return int(atomic.LoadInt32(&c.queries))
+}
+
+func newFakeClient(ttl uint32, answers ...string) *fakeClient {
+	return &fakeClient{answers: answers, ttl: ttl}
+}
+
+var errFakeClient = errors.New("fake client failed")
+
+// newTestResolver build a resolver with main as its nameservers
+func newTestResolver(config Config, main ...resolver) *Resolver {
+	r := New(config)
+	r.main = main
+	return r
+}
+
+func query(name string, qtype uint16) *D.Msg {
+	m := &D.Msg{}
+	m.SetQuestion(D.Fqdn(name), qtype)
+	return m
+}
+
+// setPolicy route the queries of domain to clients
+func setPolicy(r *Resolver, domain string, clients ...resolver) {
+	if r.policy == nil {
+		r.policy = trie.New()
+	}
+	r.policy.Insert(domain, clients)
+}
+
+func answerIP(msg *D.Msg) string {
+	if len(msg.Answer) == 0 {
+		return ""
+	}
+	switch rr := msg.Answer[0].(type) {
+	case *D.A:
+		return rr.A.String()
+	case *D.AAAA:
+		return rr.AAAA.String()
+	}
+	return ""
+}
+
+func TestResolver_Policy(t *testing.T) {
+	main := newFakeClient(60, "10.0.0.1")
+	fallback := newFakeClient(60, "10.2.0.1")
+	corp := newFakeClient(60, "10.1.0.1")
+	r := newTestResolver(Config{}, main)
+	r.fallback = []resolver{fallback}
+	setPolicy(r, "+.corp.example.com", corp)
+
+	for name, ip := range map[string]string{
+		"corp.example.com":     "10.1.0.1",
+		"www.corp.example.com": "10.1.0.1",
+		// no fallback-filter trusts the answers of main
+		"example.com": "10.2.0.1",
+	} {
+		msg, err := r.Exchange(query(name, D.TypeA))
+		assert.Nil(t, err)
+		assert.Equal(t, ip, answerIP(msg), name)
+	}
+
+	// the policy nameservers answer alone, without the fallback check
+	assert.Equal(t, 2, corp.count())
+	assert.Equal(t, 1, main.count())
+	assert.Equal(t, 1, fallback.count())
+
+	corp.err = errFakeClient
+	_, err := r.Exchange(query("new.corp.example.com", D.TypeA))
+	assert.Error(t, err)
+	assert.Equal(t, 1, main.count())
+}
+
+func TestResolver_FallbackFilter(t *testing.T) {
+	_, polluted, _ := net.ParseCIDR("240.0.0.0/4")
+	for _, tt := range []struct {
+		filter   FallbackFilter
+		answer   string
+		expected string
+	}{
+		// the answers of main in ipcidr are accepted
+		{FallbackFilter{IPCIDR: []*net.IPNet{polluted}}, "240.0.0.1", "240.0.0.1"},
+		{FallbackFilter{IPCIDR: []*net.IPNet{polluted}}, "10.0.0.1", "10.2.0.1"},
+		// ipcidr-invert accept those outside it instead
+		{FallbackFilter{IPCIDR: []*net.IPNet{polluted}, IPCIDRInvert: true}, "240.0.0.1", "10.2.0.1"},
+		{FallbackFilter{IPCIDR: []*net.IPNet{polluted}, IPCIDRInvert: true}, "10.0.0.1", "10.0.0.1"},
+		// an empty ipcidr-invert matches nothing
+		{FallbackFilter{IPCIDRInvert: true}, "10.0.0.1", "10.2.0.1"},
+	} {
+		r := New(Config{FallbackFilter: tt.filter})
+		r.main = []resolver{newFakeClient(60, tt.answer)}
+		r.fallback = []resolver{newFakeClient(60, "10.2.0.1")}
+
+		msg, err := r.Exchange(query("example.com", D.TypeA))
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, answerIP(msg), "%+v %s", tt.filter, tt.answer)
+	}
+}
+
+func TestResolver_FallbackDomain(t *testing.T) {
+	main := newFakeClient(60, "10.0.0.1")
+	fallback := newFakeClient(60, "10.2.0.1")
+	_, trusted, _ := net.ParseCIDR("10.0.0.0/8")
+	config := Config{
+		Fallback:       []NameServer{{Addr: "127.0.0.1:53"}},
+		FallbackFilter: FallbackFilter{IPCIDR: []*net.IPNet{trusted}, Domain: []string{"+.google.com"}},
+	}
+	r := newTestResolver(config, main)
+	r.fallback = []resolver{fallback}
+
+	// the domains are resolved by fallback alone, whatever main answers
+	for _, qtype := range []uint16{D.TypeA, D.TypeTXT} {
+		msg, err := r.Exchange(query("www.google.com", qtype))
+		assert.Nil(t, err)
+		if qtype == D.TypeA {
+			assert.Equal(t, "10.2.0.1", answerIP(msg))
+		}
+	}
+	assert.Equal(t, 0, main.count())
+	assert.Equal(t, 2, fallback.count())
+
+	msg, err := r.Exchange(query("example.com", D.TypeA))
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1", answerIP(msg))
+
+	// the domains are ignored without fallback
+	r = newTestResolver(Config{FallbackFilter: FallbackFilter{Domain: []string{"+.google.com"}}}, main)
+	msg, err = r.Exchange(query("www.google.com", D.TypeA))
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1", answerIP(msg))
+}
@@ -1,7 +1,14 @@
 package dns
 
 import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"io/ioutil"
 	"net"
+	"net/http"
+
+	"github.com/ClashrAuto/Clashr/log"
 
 	D "github.com/miekg/dns"
 )
@@ -10,11 +17,47 @@ var (
 	address string
 	server  = &Server{}
 
+	udpServer   *D.Server
+	tcpServer   *D.Server
+	tlsServer   *D.Server
+	httpsServer *http.Server
+
+	encryptedConfig ServerConfig
+
 	dnsDefaultTTL uint32 = 600
 )
 
+// ServerConfig is the encrypted listeners of the dns server, an empty address disables the listener
+type ServerConfig struct {
+	// TLSListen serve DNS over TLS
+	TLSListen string
+	// HTTPSListen serve DNS over HTTPS at /dns-query
+	HTTPSListen string
+	Certificate *tls.Certificate
+}
+
+func (c ServerConfig) equal(other ServerConfig) bool {
+	if c.TLSListen != other.TLSListen || c.HTTPSListen != other.HTTPSListen {
+		return false
+	}
+	if c.Certificate == nil || other.Certificate == nil {
+		return c.Certificate == other.Certificate
+	}
+
+	// the certificates loaded again from the same files are equal
+	if len(c.Certificate.Certificate) != len(other.Certificate.Certificate) {
+		return false
+	}
+	for i, der := range c.Certificate.Certificate {
+		if !bytes.Equal(der, other.Certificate.Certificate[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Server serve the queries of all listeners with the middleware chain of the resolver
 type Server struct {
-	*D.Server
 	handler handler
 }
 
@@ -31,15 +74,96 @@ func (s *Server) setHandler(handler handler) {
 	s.handler = handler
 }
 
+// ServeHTTP serve DNS over HTTPS (RFC 8484) with GET and POST
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf []byte
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		buf, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+	case http.MethodPost:
+		if r.Header.Get("content-type") != dotMimeType {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		buf, err = ioutil.ReadAll(http.MaxBytesReader(w, r.Body, D.MaxMsgSize))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	msg := &D.Msg{}
+	if err := msg.Unpack(buf); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rw := &httpResponseWriter{request: r}
+	s.ServeDNS(rw, msg)
+	if rw.msg == nil {
+		http.Error(w, "no response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", dotMimeType)
+	w.Write(rw.msg)
+}
+
+// httpResponseWriter collect the reply of a DoH request
+type httpResponseWriter struct {
+	request *http.Request
+	msg     []byte
+}
+
+func (w *httpResponseWriter) LocalAddr() net.Addr {
+	if addr, ok := w.request.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		return addr
+	}
+	return &net.TCPAddr{}
+}
+
+func (w *httpResponseWriter) RemoteAddr() net.Addr {
+	addr, _ := net.ResolveTCPAddr("tcp", w.request.RemoteAddr)
+	return addr
+}
+
+func (w *httpResponseWriter) WriteMsg(msg *D.Msg) error {
+	buf, err := msg.Pack()
+	if err != nil {
+		return err
+	}
+	w.msg = buf
+	return nil
+}
+
+func (w *httpResponseWriter) Write(buf []byte) (int, error) {
+	w.msg = append([]byte{}, buf...)
+	return len(buf), nil
+}
+
+func (w *httpResponseWriter) Close() error        { return nil }
+func (w *httpResponseWriter) TsigStatus() error   { return nil }
+func (w *httpResponseWriter) TsigTimersOnly(bool) {}
+func (w *httpResponseWriter) Hijack()             {}
+
+// ReCreateServer serve udp and tcp at addr, the listeners are kept if addr is unchanged
 func ReCreateServer(addr string, resolver *Resolver) error {
+	if resolver != nil {
+		server.setHandler(newHandler(resolver))
+	}
+
 	if addr == address && resolver != nil {
-		handler := newHandler(resolver)
-		server.setHandler(handler)
 		return nil
 	}
 
-	if server.Server != nil {
-		server.Shutdown()
+	if udpServer != nil {
+		udpServer.Shutdown()
+		tcpServer.Shutdown()
+		udpServer, tcpServer = nil, nil
 		address = ""
 	}
 
@@ -48,23 +172,75 @@ func ReCreateServer(addr string, resolver *Resolver) error {
 		return nil
 	}
 
-	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	p, err := net.ListenPacket("udp", addr)
 	if err != nil {
 		return err
 	}
 
-	p, err := net.ListenUDP("udp", udpAddr)
+	l, err := net.Listen("tcp", addr)
 	if err != nil {
+		p.Close()
 		return err
 	}
 
 	address = addr
-	handler := newHandler(resolver)
-	server = &Server{handler: handler}
-	server.Server = &D.Server{Addr: addr, PacketConn: p, Handler: server}
+	udpServer = &D.Server{Addr: addr, PacketConn: p, Handler: server}
+	tcpServer = &D.Server{Addr: addr, Listener: l, Handler: server}
+	go udpServer.ActivateAndServe()
+	go tcpServer.ActivateAndServe()
+	return nil
+}
+
+// ReCreateTLSServer serve DNS over TLS and DNS over HTTPS with the handler of ReCreateServer,
+// the listeners are restarted if the config changes
+func ReCreateTLSServer(config ServerConfig) error {
+	if config.equal(encryptedConfig) {
+		return nil
+	}
+
+	if tlsServer != nil {
+		tlsServer.Shutdown()
+		tlsServer = nil
+	}
+	if httpsServer != nil {
+		httpsServer.Close()
+		httpsServer = nil
+	}
+	encryptedConfig = ServerConfig{}
+
+	if config.Certificate == nil || (config.TLSListen == "" && config.HTTPSListen == "") {
+		return nil
+	}
+	certificates := &tls.Config{Certificates: []tls.Certificate{*config.Certificate}}
+
+	if config.TLSListen != "" {
+		l, err := tls.Listen("tcp", config.TLSListen, certificates)
+		if err != nil {
+			return err
+		}
+
+		tlsServer = &D.Server{Addr: config.TLSListen, Net: "tcp-tls", Listener: l, Handler: server}
+		go tlsServer.ActivateAndServe()
+	}
+
+	if config.HTTPSListen != "" {
+		l, err := net.Listen("tcp", config.HTTPSListen)
+		if err != nil {
+			return err
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle(dotPath, server)
+		// ServeTLS enable HTTP/2 with the certificates of TLSConfig
+		s := &http.Server{Addr: config.HTTPSListen, Handler: mux, TLSConfig: certificates.Clone()}
+		httpsServer = s
+		go func() {
+			if err := s.ServeTLS(l, "", ""); err != nil && err != http.ErrServerClosed {
+				log.Errorln("DNS over HTTPS server error: %s", err.Error())
+			}
+		}()
+	}
 
-	go func() {
-		server.ActivateAndServe()
-	}()
+	encryptedConfig = config
 	return nil
 }
@@ -0,0 +1,107 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// freeAddr return an address of 127.0.0.1 with a port free for both udp and tcp
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+	p, err := net.ListenPacket("udp", l.Addr().String())
+	assert.Nil(t, err)
+	defer p.Close()
+	return l.Addr().String()
+}
+
+// testCertificate return the self-signed certificate of httptest
+func testCertificate() *tls.Certificate {
+	s := httptest.NewTLSServer(http.NotFoundHandler())
+	defer s.Close()
+	return &s.TLS.Certificates[0]
+}
+
+func TestServer_UDPAndTCP(t *testing.T) {
+	addr := freeAddr(t)
+	assert.Nil(t, ReCreateServer(addr, newTestResolver(Config{}, newFakeClient(60, "10.0.0.1"))))
+	defer ReCreateServer("", nil)
+
+	for _, network := range []string{"udp", "tcp"} {
+		client := &D.Client{Net: network, Timeout: time.Second}
+		msg, _, err := client.Exchange(query("example.com", D.TypeA), addr)
+		if assert.Nil(t, err, network) {
+			assert.Equal(t, "10.0.0.1", answerIP(msg), network)
+		}
+	}
+
+	// the listeners are kept with a new resolver
+	assert.Nil(t, ReCreateServer(addr, newTestResolver(Config{}, newFakeClient(60, "10.0.0.2"))))
+	msg, _, err := (&D.Client{Net: "tcp", Timeout: time.Second}).Exchange(query("example.com", D.TypeA), addr)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "10.0.0.2", answerIP(msg))
+	}
+}
+
+func TestServer_TLSAndHTTPS(t *testing.T) {
+	assert.Nil(t, ReCreateServer("", newTestResolver(Config{}, newFakeClient(60, "10.0.0.1"))))
+	config := ServerConfig{TLSListen: freeAddr(t), HTTPSListen: freeAddr(t), Certificate: testCertificate()}
+	assert.Nil(t, ReCreateTLSServer(config))
+	defer ReCreateTLSServer(ServerConfig{})
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+
+	dot := &D.Client{Net: "tcp-tls", TLSConfig: tlsConfig, Timeout: time.Second}
+	msg, _, err := dot.Exchange(query("example.com", D.TypeA), config.TLSListen)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "10.0.0.1", answerIP(msg))
+	}
+
+	buf, err := query("example.com", D.TypeA).Pack()
+	assert.Nil(t, err)
+	url := "https://" + config.HTTPSListen + dotPath
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}, Timeout: time.Second}
+
+	get, _ := http.NewRequest(http.MethodGet, url+"?dns="+base64.RawURLEncoding.EncodeToString(buf), nil)
+	post, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(buf))
+	post.Header.Set("content-type", dotMimeType)
+	for _, req := range []*http.Request{get, post} {
+		resp, err := client.Do(req)
+		if !assert.Nil(t, err, req.Method) {
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, req.Method)
+		assert.Equal(t, dotMimeType, resp.Header.Get("content-type"))
+
+		msg := &D.Msg{}
+		if assert.Nil(t, msg.Unpack(body), req.Method) {
+			assert.Equal(t, "10.0.0.1", answerIP(msg), req.Method)
+		}
+	}
+
+	// a wrong content type or a malformed message is rejected
+	bad, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(buf))
+	bad.Header.Set("content-type", "text/plain")
+	resp, err := client.Do(bad)
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	}
+	resp, err = client.Get(url + "?dns=AAAA")
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+}
@@ -4,10 +4,7 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"errors"
-	"time"
 
-	"github.com/ClashrAuto/Clashr/common/cache"
-	"github.com/ClashrAuto/Clashr/log"
 	yaml "gopkg.in/yaml.v2"
 
 	D "github.com/miekg/dns"
@@ -79,22 +76,6 @@ func (e EnhancedMode) String() string {
 	}
 }
 
-func putMsgToCache(c *cache.Cache, key string, msg *D.Msg) {
-	var ttl time.Duration
-	if len(msg.Answer) != 0 {
-		ttl = time.Duration(msg.Answer[0].Header().Ttl) * time.Second
-	} else if len(msg.Ns) != 0 {
-		ttl = time.Duration(msg.Ns[0].Header().Ttl) * time.Second
-	} else if len(msg.Extra) != 0 {
-		ttl = time.Duration(msg.Extra[0].Header().Ttl) * time.Second
-	} else {
-		log.Debugln("[DNS] response msg error: %#v", msg)
-		return
-	}
-
-	c.Put(key, msg.Copy(), ttl)
-}
-
 func setMsgTTL(msg *D.Msg, ttl uint32) {
 	for _, answer := range msg.Answer {
 		answer.Header().Ttl = ttl
@@ -116,11 +97,12 @@ func isIPRequest(q D.Question) bool {
 	return false
 }
 
-func transform(servers []NameServer) []resolver {
+// transform build the clients of servers, their hostnames are resolved by bootstrap if it is not nil
+func transform(servers []NameServer, bootstrap *Resolver) []resolver {
 	ret := []resolver{}
 	for _, s := range servers {
 		if s.Net == "https" {
-			ret = append(ret, &dohClient{url: s.Addr})
+			ret = append(ret, newDoHClient(s.Addr, s.Proxy, bootstrap))
 			continue
 		}
 
@@ -134,7 +116,9 @@ func transform(servers []NameServer) []resolver {
 				},
 				UDPSize: 4096,
 			},
-			Address: s.Addr,
+			Address:   s.Addr,
+			proxy:     s.Proxy,
+			bootstrap: bootstrap,
 		})
 	}
 	return ret
@@ -1,3 +1,35 @@
 module github.com/ClashrAuto/Clashr
 
-go 1.13
+go 1.25.0
+
+require (
+	github.com/go-chi/chi v1.5.5
+	github.com/go-chi/cors v1.2.2
+	github.com/go-chi/render v1.0.3
+	github.com/gofrs/uuid v4.4.0+incompatible
+	github.com/gorilla/websocket v1.5.3
+	github.com/miekg/dns v1.1.73
+	github.com/oschwald/geoip2-golang v1.13.0
+	github.com/sirupsen/logrus v1.10.2
+	github.com/stretchr/testify v1.12.1
+	golang.org/x/crypto v0.54.0
+	golang.org/x/net v0.57.0
+	golang.org/x/sync v0.22.0
+	golang.zx2c4.com/wireguard v0.0.0-20231211153847-12269c276173
+	gopkg.in/eapache/channels.v1 v1.1.0
+	gopkg.in/yaml.v2 v2.4.0
+	lukechampine.com/blake3 v1.4.1
+)
+
+require (
+	github.com/ajg/form v1.5.1 // indirect
+	github.com/eapache/queue v1.1.0 // indirect
+	github.com/google/btree v1.0.1 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.9 // indirect
+	github.com/oschwald/maxminddb-golang v1.13.0 // indirect
+	go.yaml.in/yaml/v3 v3.0.5 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/time v0.0.0-20220210224613-90d013bbcef8 // indirect
+	golang.zx2c4.com/wintun v0.0.0-20230126152724-0fa3db229ce2 // indirect
+	gvisor.dev/gvisor v0.0.0-20230927004350-cbd86285d259 // indirect
+)
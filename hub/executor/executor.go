@@ -1,8 +1,15 @@
 package executor
 
 import (
+	"sync"
+	"time"
+
+	A "github.com/ClashrAuto/Clashr/adapters/outbound"
 	"github.com/ClashrAuto/Clashr/component/auth"
+	"github.com/ClashrAuto/Clashr/component/dialer"
 	trie "github.com/ClashrAuto/Clashr/component/domain-trie"
+	"github.com/ClashrAuto/Clashr/component/fakeip"
+	"github.com/ClashrAuto/Clashr/component/profile"
 	"github.com/ClashrAuto/Clashr/config"
 	C "github.com/ClashrAuto/Clashr/constant"
 	"github.com/ClashrAuto/Clashr/dns"
@@ -12,6 +19,50 @@ import (
 	T "github.com/ClashrAuto/Clashr/tunnel"
 )
 
+var (
+	selectedStore *profile.SelectedStore
+	selectedOnce  sync.Once
+
+	fakeIPStore     *profile.FakeIPStore
+	fakeIPStoreOnce sync.Once
+)
+
+// selected return the store of selections, it is created on first use so that the home dir is set
+func selected() *profile.SelectedStore {
+	selectedOnce.Do(func() {
+		selectedStore = profile.NewSelectedStore(C.Path.Selected(), time.Second)
+	})
+	return selectedStore
+}
+
+// fakeIP return the store of fake-ip bindings, it is created on first use so that the home dir is set
+func fakeIP() *profile.FakeIPStore {
+	fakeIPStoreOnce.Do(func() {
+		fakeIPStore = profile.NewFakeIPStore(C.Path.FakeIP(), 5*time.Second)
+	})
+	return fakeIPStore
+}
+
+// ClearFakeIP drop all the fake ips allocated and the persisted ones
+func ClearFakeIP() error {
+	return fakeIP().Clear()
+}
+
+// SetSelected persist the proxy selected in a select group
+func SetSelected(group, name string) {
+	selected().Set(group, name)
+}
+
+// Shutdown write the pending states before exit
+func Shutdown() {
+	if err := selected().Flush(); err != nil {
+		log.Errorln("Save selected proxies error: %s", err.Error())
+	}
+	if err := fakeIP().Flush(); err != nil {
+		log.Errorln("Save fake-ip bindings error: %s", err.Error())
+	}
+}
+
 // Parse config with default config path
 func Parse() (*config.Config, error) {
 	return ParseWithPath(C.Path.Config())
@@ -25,6 +76,7 @@ func ParseWithPath(path string) (*config.Config, error) {
 // ApplyConfig dispatch configure to all parts
 func ApplyConfig(cfg *config.Config, force bool) {
 	updateUsers(cfg.Users)
+	updateSocketOption(cfg.General)
 	if force {
 		updateGeneral(cfg.General)
 	}
@@ -53,6 +105,12 @@ func GetGeneral() *config.General {
 		LogLevel:       log.Level(),
 	}
 
+	opt := dialer.Default()
+	general.Interface = opt.Interface
+	general.RoutingMark = opt.RoutingMark
+	general.SourceIP = opt.SourceIP
+	general.IPVersion = dialer.GetIPVersion()
+
 	return general
 }
 
@@ -61,20 +119,39 @@ func updateExperimental(c *config.Experimental) {
 }
 
 func updateDNS(c *config.DNS) {
+	// restore the fake ips allocated before the restart or reload, so the clients can still use them
+	pools := []*fakeip.Pool{}
+	if c.Enable {
+		pools = append(pools, c.FakeIPRange, c.FakeIPRange6)
+	}
+	if err := fakeIP().Attach(pools...); err != nil {
+		log.Errorln("Save fake-ip bindings error: %s", err.Error())
+	}
+
 	if c.Enable == false {
 		dns.DefaultResolver = nil
 		_ = dns.ReCreateServer("", nil)
+		_ = dns.ReCreateTLSServer(dns.ServerConfig{})
 		return
 	}
 	r := dns.New(dns.Config{
 		Main:         c.NameServer,
 		Fallback:     c.Fallback,
+		Default:      c.DefaultNameServer,
+		Policy:       c.NameServerPolicy,
 		IPv6:         c.IPv6,
 		EnhancedMode: c.EnhancedMode,
 		Pool:         c.FakeIPRange,
+		Pool6:        c.FakeIPRange6,
+		FakeIPFilter: c.FakeIPFilter,
+		Blocker:      c.Blocker,
+		Cache:        c.Cache,
+		ProxyServers: c.ProxyServers,
 		FallbackFilter: dns.FallbackFilter{
-			GeoIP:  c.FallbackFilter.GeoIP,
-			IPCIDR: c.FallbackFilter.IPCIDR,
+			GeoIP:        c.FallbackFilter.GeoIP,
+			IPCIDR:       c.FallbackFilter.IPCIDR,
+			IPCIDRInvert: c.FallbackFilter.IPCIDRInvert,
+			Domain:       c.FallbackFilter.Domain,
 		},
 	})
 	dns.DefaultResolver = r
@@ -86,6 +163,31 @@ func updateDNS(c *config.DNS) {
 	if c.Listen != "" {
 		log.Infoln("DNS server listening at: %s", c.Listen)
 	}
+
+	if err := dns.ReCreateTLSServer(dns.ServerConfig{
+		TLSListen:   c.TLSListen,
+		HTTPSListen: c.HTTPSListen,
+		Certificate: c.Certificate,
+	}); err != nil {
+		log.Errorln("Start DNS over TLS/HTTPS server error: %s", err.Error())
+		return
+	}
+
+	if c.TLSListen != "" {
+		log.Infoln("DNS over TLS server listening at: %s", c.TLSListen)
+	}
+	if c.HTTPSListen != "" {
+		log.Infoln("DNS over HTTPS server listening at: %s", c.HTTPSListen)
+	}
+}
+
+func updateSocketOption(general *config.General) {
+	dialer.SetDefault(&dialer.Option{
+		Interface:   general.Interface,
+		RoutingMark: general.RoutingMark,
+		SourceIP:    general.SourceIP,
+	})
+	dialer.SetIPVersion(general.IPVersion)
 }
 
 func updateHosts(tree *trie.Trie) {
@@ -101,9 +203,32 @@ func updateProxies(proxies map[string]C.Proxy) {
 		proxy.Destroy()
 	}
 
+	restoreSelected(proxies)
 	tunnel.UpdateProxies(proxies)
 }
 
+// restoreSelected select the persisted proxy of select groups if it still exists
+func restoreSelected(proxies map[string]C.Proxy) {
+	store := selected()
+	for name, proxy := range proxies {
+		p, ok := proxy.(*A.Proxy)
+		if !ok {
+			continue
+		}
+
+		selector, ok := p.ProxyAdapter.(*A.Selector)
+		if !ok {
+			continue
+		}
+
+		if selected, exist := store.Get(name); exist {
+			if err := selector.Set(selected); err != nil {
+				log.Warnln("Restore %s of %s error: %s", selected, name, err.Error())
+			}
+		}
+	}
+}
+
 func updateRules(rules []C.Rule) {
 	T.Instance().UpdateRules(rules)
 }
@@ -23,3 +23,8 @@ func Parse() error {
 	executor.ApplyConfig(cfg, true)
 	return nil
 }
+
+// Shutdown call at the exit of clash
+func Shutdown() {
+	executor.Shutdown()
+}
@@ -0,0 +1,74 @@
+package route
+
+import (
+	"net/http"
+
+	"github.com/ClashrAuto/Clashr/dns"
+	"github.com/ClashrAuto/Clashr/hub/executor"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+func dnsRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/cache", getCacheStats)
+	r.Delete("/fakeip", flushFakeIP)
+	r.Get("/blocklist", getBlocklists)
+	r.Put("/blocklist", reloadBlocklists)
+	return r
+}
+
+func getCacheStats(w http.ResponseWriter, r *http.Request) {
+	resolver := dns.DefaultResolver
+	if resolver == nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, newError("DNS is not enabled"))
+		return
+	}
+	render.JSON(w, r, resolver.CacheStats())
+}
+
+func flushFakeIP(w http.ResponseWriter, r *http.Request) {
+	if err := executor.ClearFakeIP(); err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, newError(err.Error()))
+		return
+	}
+	render.NoContent(w, r)
+}
+
+func getBlocklists(w http.ResponseWriter, r *http.Request) {
+	blocker := currentBlocker()
+	if blocker == nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, newError("DNS blocklist is not enabled"))
+		return
+	}
+	render.JSON(w, r, render.M{
+		"lists": blocker.Stats(),
+	})
+}
+
+func reloadBlocklists(w http.ResponseWriter, r *http.Request) {
+	blocker := currentBlocker()
+	if blocker == nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, newError("DNS blocklist is not enabled"))
+		return
+	}
+
+	if err := blocker.Reload(); err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, newError(err.Error()))
+		return
+	}
+	render.NoContent(w, r)
+}
+
+func currentBlocker() *dns.Blocker {
+	if resolver := dns.DefaultResolver; resolver != nil {
+		return resolver.Blocker()
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package route
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	A "github.com/ClashrAuto/Clashr/adapters/outbound"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+func groupRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Route("/{name}", func(r chi.Router) {
+		r.Use(parseProxyName, findProxyByName)
+		r.Get("/delay", getGroupDelay)
+	})
+	return r
+}
+
+func getGroupDelay(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	testURL := query.Get("url")
+	if u, err := url.Parse(testURL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, newError("url must be a http or https url"))
+		return
+	}
+
+	timeout, err := strconv.ParseInt(query.Get("timeout"), 10, 16)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, ErrBadRequest)
+		return
+	}
+	recursive := query.Get("recursive") == "true"
+
+	proxy := r.Context().Value(CtxKeyProxy).(*A.Proxy)
+	group, ok := proxy.ProxyAdapter.(A.ProxyGroup)
+	if !ok {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, newError("Must be a proxy group"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*time.Duration(timeout))
+	defer cancel()
+
+	render.JSON(w, r, A.URLTestGroup(ctx, group, testURL, recursive))
+}
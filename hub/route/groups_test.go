@@ -0,0 +1,32 @@
+package route
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	A "github.com/ClashrAuto/Clashr/adapters/outbound"
+	C "github.com/ClashrAuto/Clashr/constant"
+	T "github.com/ClashrAuto/Clashr/tunnel"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupDelay_InvalidURL(t *testing.T) {
+	direct := A.NewProxy(A.NewDirect())
+	selector, err := A.NewSelector("select", []C.Proxy{direct})
+	assert.Nil(t, err)
+	T.Instance().UpdateProxies(map[string]C.Proxy{"select": A.NewProxy(selector)})
+
+	for _, query := range []string{
+		"timeout=100",
+		"timeout=100&url=",
+		"timeout=100&url=" + "%25zz",
+		"timeout=100&url=generate_204",
+		"timeout=100&url=ftp://example.com",
+	} {
+		w := httptest.NewRecorder()
+		groupRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/select/delay?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	A "github.com/ClashrAuto/Clashr/adapters/outbound"
 	C "github.com/ClashrAuto/Clashr/constant"
+	"github.com/ClashrAuto/Clashr/hub/executor"
 	T "github.com/ClashrAuto/Clashr/tunnel"
 
 	"github.com/go-chi/chi"
@@ -94,6 +95,7 @@ func updateProxy(w http.ResponseWriter, r *http.Request) {
 		render.JSON(w, r, newError(fmt.Sprintf("Selector update error: %s", err.Error())))
 		return
 	}
+	executor.SetSelected(proxy.Name(), req.Name)
 
 	render.NoContent(w, r)
 }
@@ -66,7 +66,9 @@ func Start(addr string, secret string) {
 		r.Get("/traffic", traffic)
 		r.Mount("/configs", configRouter())
 		r.Mount("/proxies", proxyRouter())
+		r.Mount("/group", groupRouter())
 		r.Mount("/rules", ruleRouter())
+		r.Mount("/dns", dnsRouter())
 		r.Mount("/sysproxy", systemProxySettingRouter())
 	})
 
@@ -2,10 +2,12 @@ package tunnel
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"net"
 	"net/http"
 	"strings"
+	"syscall"
 	"time"
 
 	adapters "github.com/ClashrAuto/Clashr/adapters/inbound"
@@ -28,12 +30,14 @@ func (t *Tunnel) handleHTTP(request *adapters.HTTPAdapter, outbound net.Conn) {
 		adapters.RemoveHopByHopHeaders(req.Header)
 		err := req.Write(conn)
 		if err != nil {
+			passReset(request.Conn, err)
 			break
 		}
 
 	handleResponse:
 		resp, err := http.ReadResponse(outboundReeder, req)
 		if err != nil {
+			passReset(request.Conn, err)
 			break
 		}
 		adapters.RemoveHopByHopHeaders(resp.Header)
@@ -109,11 +113,24 @@ func (t *Tunnel) handleUDPToLocal(conn net.Conn, pc net.PacketConn, key string,
 
 func (t *Tunnel) handleSocket(request *adapters.SocketAdapter, outbound net.Conn) {
 	conn := newTrafficTrack(outbound, t.traffic)
-	relay(request, conn)
+	passReset(request.Conn, relay(request, conn))
 }
 
-// relay copies between left and right bidirectionally.
-func relay(leftConn, rightConn net.Conn) {
+// passReset let conn be closed with a RST if the outbound was reset, e.g. by REJECT,
+// so that the client fails fast instead of treating it as an empty response.
+func passReset(conn net.Conn, err error) {
+	if !errors.Is(err, syscall.ECONNRESET) {
+		return
+	}
+
+	if c, ok := conn.(*net.TCPConn); ok {
+		c.SetLinger(0)
+	}
+}
+
+// relay copies between left and right bidirectionally,
+// the returned error is the one of copying from right to left.
+func relay(leftConn, rightConn net.Conn) error {
 	ch := make(chan error)
 
 	go func() {
@@ -128,5 +145,5 @@ func relay(leftConn, rightConn net.Conn) {
 	io.CopyBuffer(rightConn, leftConn, buf)
 	pool.BufPool.Put(buf[:cap(buf)])
 	rightConn.SetReadDeadline(time.Now())
-	<-ch
+	return <-ch
 }
@@ -127,7 +127,8 @@ func (t *Tunnel) resolveMetadata(metadata *C.Metadata) (C.Proxy, C.Rule, error)
 		if exist {
 			metadata.Host = host
 			metadata.AddrType = C.AtypDomainName
-			if dns.DefaultResolver.IsFakeIP() {
+			// the real ips of fake-ip-filter domains are kept
+			if dns.DefaultResolver.IsFakeIPAddr(*metadata.DstIP) {
 				metadata.DstIP = nil
 			}
 		}